@@ -2,10 +2,12 @@ package accounting
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
+	"github.com/sklarsa/crypto-taxes/prices"
 )
 
 // NegativeQuantityErr is an error for a transaction with a negative quantity
@@ -22,34 +24,203 @@ func (m *NegativeSpotErr) Error() string {
 	return "Spot price must be > 0"
 }
 
-// Action is either a buy or sale of a crypto
+// NegativeFeeErr is an error for a transaction with a negative fee
+type NegativeFeeErr struct{}
+
+func (m *NegativeFeeErr) Error() string {
+	return "Fee must be >= 0"
+}
+
+// MissingPriceErr is an error for a transaction without the price of an
+// asset it needs, such as a trade between two cryptos or a fee paid in a
+// third asset, which can only be found in a price history
+type MissingPriceErr struct {
+	Asset string
+	Time  time.Time
+}
+
+func (m *MissingPriceErr) Error() string {
+	return fmt.Sprintf("No price of %s on %s, which needs a price history to be valued", m.Asset, m.Time.Format(time.RFC3339))
+}
+
+// CurrencyMismatchErr is an error for a transaction in a different
+// currency than the account
+type CurrencyMismatchErr struct {
+	Expected string
+	Found    string
+}
+
+func (m *CurrencyMismatchErr) Error() string {
+	return fmt.Sprintf("Transaction currency %s does not match account currency %s", m.Found, m.Expected)
+}
+
+// Action is the kind of crypto event a Transaction records
 type Action int
 
 const (
 	// BUY is a purchase event of crypto
 	BUY Action = iota
-	// SELL is a crypto sale event, including conversion into a different asset or paying for an order
+	// SELL is a crypto sale event, including paying for an order
 	SELL Action = iota
+	// CONVERT is a swap of one crypto for another, disposing of Asset and
+	// acquiring ToAsset
+	CONVERT Action = iota
+	// TRANSFER_OUT moves crypto to another wallet or account without
+	// disposing of it
+	TRANSFER_OUT Action = iota
+	// TRANSFER_IN receives crypto previously moved out by a TRANSFER_OUT
+	TRANSFER_IN Action = iota
+	// INCOME is crypto received as ordinary income, such as rewards, staking
+	// or interest
+	INCOME Action = iota
+	// GIFT_IN is crypto received as a gift, keeping the donor's basis and
+	// acquisition date
+	GIFT_IN Action = iota
+	// GIFT_OUT is crypto given away as a gift, which is not a sale
+	GIFT_OUT Action = iota
 )
 
-// TransactionTypeToAction converts Coinbase transaction types into BUY or SELL Actions
+var actionNames = []string{"BUY", "SELL", "CONVERT", "TRANSFER_OUT", "TRANSFER_IN", "INCOME", "GIFT_IN", "GIFT_OUT"}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// ParseAction returns the Action with the given name, e.g. BUY or transfer_in
+func ParseAction(name string) (Action, error) {
+	for i, actionName := range actionNames {
+		if strings.EqualFold(strings.TrimSpace(name), actionName) {
+			return Action(i), nil
+		}
+	}
+	return BUY, fmt.Errorf("Unknown action '%s'", name)
+}
+
+// TransactionTypeToAction converts Coinbase transaction types into Actions.
+// A Send is treated as a transfer to another wallet; set its Action to SELL
+// when it is a genuine disposal such as a payment, or to GIFT_OUT when it is
+// a gift.
 var TransactionTypeToAction = map[string]Action{
-	"Buy":               BUY,
-	"Sell":              SELL,
-	"Paid for an order": SELL,
-	"Send":              SELL,
-	"Convert":           SELL,
-	"Coinbase Earn":     BUY,
+	"Buy":                 BUY,
+	"Sell":                SELL,
+	"Advanced Trade Buy":  BUY,
+	"Advanced Trade Sell": SELL,
+	"Paid for an order":   SELL,
+	"Send":                TRANSFER_OUT,
+	"Receive":             TRANSFER_IN,
+	"Convert":             CONVERT,
+	"Coinbase Earn":       INCOME,
+	"Rewards Income":      INCOME,
+	"Staking Income":      INCOME,
+	"Learning Reward":     INCOME,
+	"Inflation Reward":    INCOME,
 }
 
 // Transaction is a crypto transaction as reported by Coinbase
 type Transaction struct {
+	// ID is the identifier given by the source of the transaction, if any,
+	// and Source is the export format it was read from, if known
+	ID        string
+	Source    string
 	Timestamp time.Time
-	Action    Action
-	Asset     string
-	Quantity  decimal.Decimal
-	Spot      decimal.Decimal
-	Currency  string
+	// Wallet is the wallet or address the transaction was made from, when
+	// the source has more than one
+	Wallet   string
+	Action   Action
+	Asset    string
+	Quantity decimal.Decimal
+	// Spot is zero when the source has no fiat price for the transaction
+	Spot decimal.Decimal
+	// Fee is the total fee paid, in Currency
+	Fee      decimal.Decimal
+	Currency string
+
+	// ToAsset and ToQuantity are the asset received by a CONVERT
+	ToAsset    string
+	ToQuantity decimal.Decimal
+
+	// A fee paid in a third asset, such as BNB on Binance, is FeeQuantity of
+	// FeeAsset worth FeeSpot each in Currency
+	FeeAsset    string
+	FeeQuantity decimal.Decimal
+	FeeSpot     decimal.Decimal
+
+	// Rate is the exchange rate the amounts were converted to Currency at
+	// from OriginalCurrency, and is zero when they were not converted
+	OriginalCurrency string
+	Rate             decimal.Decimal
+
+	// Counterparty is the donor of a GIFT_IN or the recipient of a GIFT_OUT
+	Counterparty string
+	// DonorBasis is the donor's total cost basis of a GIFT_IN, in Currency,
+	// and DonorAcquired the date the donor acquired it
+	DonorBasis    decimal.Decimal
+	DonorAcquired time.Time
+}
+
+// FeeValue is the value (in Currency) of the fee paid in FeeAsset
+func (t Transaction) FeeValue() decimal.Decimal {
+	return t.FeeQuantity.Mul(t.FeeSpot)
+}
+
+// needsSpot returns true if a transaction of action cannot be processed
+// without a spot price.  Transfers only need one for shares received without
+// a matching TRANSFER_OUT, and gifts given only for reporting their value.
+func needsSpot(action Action) bool {
+	switch action {
+	case BUY, SELL, CONVERT, INCOME, GIFT_IN:
+		return true
+	}
+	return false
+}
+
+// Unpriced returns the assets whose price the transaction needs but does not
+// have, which must be found in a price history
+func (t Transaction) Unpriced() []string {
+	assets := make([]string, 0)
+	if t.Spot.IsZero() && needsSpot(t.Action) {
+		assets = append(assets, t.Asset)
+	}
+	if t.FeeAsset != "" && t.FeeSpot.IsZero() {
+		assets = append(assets, t.FeeAsset)
+	}
+	return assets
+}
+
+// Legs splits a CONVERT into the SELL of Asset and the BUY of ToAsset.  The
+// asset received is valued at the net proceeds of the asset disposed of.
+func (t Transaction) Legs() (*Transaction, *Transaction) {
+	sell := &Transaction{
+		Timestamp: t.Timestamp,
+		Action:    SELL,
+		Asset:     t.Asset,
+		Quantity:  t.Quantity,
+		Spot:      t.Spot,
+		Fee:       t.Fee,
+		Currency:  t.Currency,
+
+		OriginalCurrency: t.OriginalCurrency,
+		Rate:             t.Rate,
+	}
+
+	buy := &Transaction{
+		Timestamp: t.Timestamp,
+		Action:    BUY,
+		Asset:     t.ToAsset,
+		Quantity:  t.ToQuantity,
+		Currency:  t.Currency,
+
+		OriginalCurrency: t.OriginalCurrency,
+		Rate:             t.Rate,
+	}
+	if t.ToQuantity.GreaterThan(decimal.Zero) {
+		buy.Spot = t.Quantity.Mul(t.Spot).Sub(t.Fee).Div(t.ToQuantity)
+	}
+
+	return sell, buy
 }
 
 // ToLot converts a transaction to a Lot used for accounting purposes
@@ -58,27 +229,137 @@ func (t Transaction) ToLot() *Lot {
 		PurchaseDate: t.Timestamp,
 		Quantity:     t.Quantity,
 		Spot:         t.Spot,
+		Fees:         t.Fee,
+		Currency:     t.Currency,
+
+		OriginalCurrency: t.OriginalCurrency,
+		Rate:             t.Rate,
 	}
 }
 
 // Lot is an amount of crypto purchased in a single event.  Used for
 // calculating cost basis and date purchased for accounting purposes.
 type Lot struct {
-	PurchaseDate time.Time
-	Quantity     decimal.Decimal
-	Spot         decimal.Decimal
+	PurchaseDate time.Time       `json:"purchase_date"`
+	Quantity     decimal.Decimal `json:"quantity"`
+	Spot         decimal.Decimal `json:"spot"`
+	// Fees paid on the purchase are capitalized into the lot's cost.  They
+	// are in Currency, like Spot.
+	Fees     decimal.Decimal `json:"fees"`
+	Currency string          `json:"currency,omitempty"`
+
+	// Rate is the exchange rate Spot and Fees were converted to Currency at
+	// from OriginalCurrency, the currency the lot was bought in, and is zero
+	// when they were not converted
+	OriginalCurrency string          `json:"original_currency,omitempty"`
+	Rate             decimal.Decimal `json:"rate"`
+
+	// Adjustment is added to the cost basis, such as a loss disallowed by
+	// the wash sale rule when the lot is its Replacement
+	Adjustment  decimal.Decimal `json:"adjustment"`
+	Replacement bool            `json:"replacement,omitempty"`
+	// HoldingSince is when the holding period of a Replacement began, which
+	// includes that of the shares it replaced.  It is zero for other lots,
+	// whose holding period begins on PurchaseDate.
+	HoldingSince time.Time `json:"holding_since"`
+
+	// GiftValue is the value on GiftDate of a gift that was worth less than
+	// the donor's basis when it was received, and zero for other lots
+	GiftDate  time.Time       `json:"gift_date"`
+	GiftValue decimal.Decimal `json:"gift_value"`
 }
 
-// TotalCost is the cost (in USD) of a lot
+// TotalCost is the cost (in Currency) of a lot, including fees and adjustments
 func (l Lot) TotalCost() decimal.Decimal {
-	return l.Quantity.Mul(l.Spot)
+	return l.Quantity.Mul(l.Spot).Add(l.Fees).Add(l.Adjustment)
+}
+
+// OriginalCost is the cost of a lot in the currency it was bought in, and
+// that currency
+func (l Lot) OriginalCost() (decimal.Decimal, string) {
+	if l.Rate.IsZero() {
+		return l.TotalCost(), l.Currency
+	}
+	return l.TotalCost().Div(l.Rate), l.OriginalCurrency
+}
+
+// basis returns the cost basis and purchase date of a lot sold for
+// proceeds.  A gift with a GiftValue has a dual basis: its basis for a loss
+// is its GiftValue, with a holding period from GiftDate, and selling it for
+// between its GiftValue and its cost is neither a gain nor a loss.
+func (l Lot) basis(proceeds decimal.Decimal) (decimal.Decimal, time.Time) {
+	cost := l.TotalCost()
+	if l.GiftValue.IsZero() || proceeds.GreaterThanOrEqual(cost) {
+		return cost, l.PurchaseDate
+	}
+	if proceeds.LessThan(l.GiftValue) {
+		return l.GiftValue, l.GiftDate
+	}
+	return proceeds, l.PurchaseDate
+}
+
+// holdingSince returns when the holding period of the lot began
+func (l Lot) holdingSince() time.Time {
+	if l.HoldingSince.IsZero() {
+		return l.PurchaseDate
+	}
+	return l.HoldingSince
+}
+
+// UnitCost is the cost (in Currency) of a single share of the lot, including fees
+func (l Lot) UnitCost() decimal.Decimal {
+	if l.Quantity.IsZero() {
+		return l.Spot
+	}
+	return l.TotalCost().Div(l.Quantity)
+}
+
+// Holding tracks the cost basis of a single asset held in an Account
+type Holding interface {
+	// Buy adds a lot to the holding
+	Buy(l *Lot) error
+	// Sell disposes of shares, sending the resulting Sales to the sales channel
+	Sell(quantity decimal.Decimal, spot decimal.Decimal, fee decimal.Decimal, date time.Time, sales chan<- *Sale) error
+	// Flush sends any Sales the holding has deferred to the sales channel
+	Flush(sales chan<- *Sale) error
+	// Quantity returns the number of shares held
+	Quantity() decimal.Decimal
+	// TotalCost returns the cost basis of the shares held
+	TotalCost() decimal.Decimal
+}
+
+// BasisModel determines how an Account tracks the cost basis of its holdings
+type BasisModel int
+
+const (
+	// LOTS tracks every purchase as a discrete Lot in a LotHistory
+	LOTS BasisModel = iota
+	// SECTION_104 pools all shares of an asset using the UK Section 104 rules
+	SECTION_104 BasisModel = iota
+	// ADJUSTED_COST_BASE pools all shares of an asset using the Canadian ACB rules
+	ADJUSTED_COST_BASE BasisModel = iota
+)
+
+// ParseBasisModel returns the BasisModel for a name (lots, s104 or acb)
+func ParseBasisModel(name string) (BasisModel, error) {
+	switch strings.ToLower(name) {
+	case "lots":
+		return LOTS, nil
+	case "s104":
+		return SECTION_104, nil
+	case "acb":
+		return ADJUSTED_COST_BASE, nil
+	}
+	return LOTS, fmt.Errorf("Unknown basis model '%s'", name)
 }
 
 // LotHistory is a queue data structure that is used to account for all lots
-// of a specific crypto asset.
+// of a specific crypto asset.  Method determines which lots are sold first,
+// defaulting to FIFO when nil.
 type LotHistory struct {
-	Asset string
-	Lots  []*Lot
+	Asset  string
+	Lots   []*Lot
+	Method LotSelectionMethod
 }
 
 // Buy adds a lot to the lot record
@@ -91,6 +372,10 @@ func (h *LotHistory) Buy(l *Lot) error {
 		return &NegativeSpotErr{}
 	}
 
+	if l.Fees.LessThan(decimal.Zero) {
+		return &NegativeFeeErr{}
+	}
+
 	if len(h.Lots) > 0 {
 		if l.PurchaseDate.Before(h.tail().PurchaseDate) {
 			return fmt.Errorf("Transactions must be in chronological order.  BUY on %s is prior to most recent BUY dated %s", l.PurchaseDate, h.tail().PurchaseDate)
@@ -102,21 +387,56 @@ func (h *LotHistory) Buy(l *Lot) error {
 	return nil
 }
 
-func (h *LotHistory) pop() (*Lot, error) {
-	if len(h.Lots) == 0 {
-		return nil, fmt.Errorf("%s len is 0, cannot pop element off empty slice", h.Asset)
+func (h *LotHistory) remove(i int) (*Lot, error) {
+	if i < 0 || i >= len(h.Lots) {
+		return nil, fmt.Errorf("%s has no lot at index %d", h.Asset, i)
 	}
-	lot := h.Lots[0]
-	h.Lots = h.Lots[1:]
+	lot := h.Lots[i]
+	h.Lots = append(h.Lots[:i], h.Lots[i+1:]...)
 	return lot, nil
 }
 
-func (h *LotHistory) peek() *Lot {
-	if len(h.Lots) == 0 {
-		return nil
+// split takes up to quantity shares from the lot at index i, returning them
+// as a separate Lot.  The lot is removed once all of its shares are taken.
+func (h *LotHistory) split(i int, quantity decimal.Decimal) (*Lot, error) {
+	if i < 0 || i >= len(h.Lots) {
+		return nil, fmt.Errorf("%s has no lot at index %d", h.Asset, i)
 	}
 
-	return h.Lots[0]
+	lot := h.Lots[i]
+	if quantity.GreaterThanOrEqual(lot.Quantity) {
+		return h.remove(i)
+	}
+
+	part := &Lot{
+		PurchaseDate: lot.PurchaseDate,
+		Quantity:     quantity,
+		Spot:         lot.Spot,
+		Fees:         share(lot.Fees, quantity, lot.Quantity),
+		Currency:     lot.Currency,
+
+		OriginalCurrency: lot.OriginalCurrency,
+		Rate:             lot.Rate,
+
+		Adjustment:   share(lot.Adjustment, quantity, lot.Quantity),
+		Replacement:  lot.Replacement,
+		HoldingSince: lot.HoldingSince,
+
+		GiftDate:  lot.GiftDate,
+		GiftValue: share(lot.GiftValue, quantity, lot.Quantity),
+	}
+	lot.Quantity = lot.Quantity.Sub(quantity)
+	lot.Fees = lot.Fees.Sub(part.Fees)
+	lot.Adjustment = lot.Adjustment.Sub(part.Adjustment)
+	lot.GiftValue = lot.GiftValue.Sub(part.GiftValue)
+	return part, nil
+}
+
+func (h *LotHistory) method() LotSelectionMethod {
+	if h.Method == nil {
+		return FIFO{}
+	}
+	return h.Method
 }
 
 func (h *LotHistory) tail() *Lot {
@@ -128,8 +448,9 @@ func (h *LotHistory) tail() *Lot {
 }
 
 // Sell processes a transaction against this LotHistory, adding any
-// resulting Sale events to the sales channel
-func (h *LotHistory) Sell(quantity decimal.Decimal, spot decimal.Decimal, date time.Time, sales chan<- *Sale) error {
+// resulting Sale events to the sales channel.  The fee is deducted from
+// the proceeds, split pro-rata when the sale spans multiple lots.
+func (h *LotHistory) Sell(quantity decimal.Decimal, spot decimal.Decimal, fee decimal.Decimal, date time.Time, sales chan<- *Sale) error {
 
 	if quantity.LessThanOrEqual(decimal.Zero) {
 		return &NegativeQuantityErr{}
@@ -139,44 +460,77 @@ func (h *LotHistory) Sell(quantity decimal.Decimal, spot decimal.Decimal, date t
 		return &NegativeSpotErr{}
 	}
 
-	var cost decimal.Decimal
+	if fee.LessThan(decimal.Zero) {
+		return &NegativeFeeErr{}
+	}
+
 	remaining := quantity
-	var proceeds decimal.Decimal
 	for ok := true; ok; ok = remaining.GreaterThan(decimal.Zero) {
-		lot := h.peek()
-		if lot == nil {
+		if len(h.Lots) == 0 {
 			return fmt.Errorf("No more lots available. Sold more shares than bought. %s shares remaining", remaining)
 		}
-		switch remaining.Cmp(lot.Quantity) {
-		case -1:
-			cost = remaining.Mul(lot.Spot)
-			proceeds = remaining.Mul(spot)
-			lot.Quantity = lot.Quantity.Sub(remaining)
-			remaining = decimal.Zero
-		default:
-			lot, err := h.pop()
-			if err != nil {
-				return err
-			}
-			cost = lot.TotalCost()
-			proceeds = lot.Quantity.Mul(spot)
-			remaining = remaining.Sub(lot.Quantity)
+		lot, err := h.split(h.method().Next(h.Lots, date), remaining)
+		if err != nil {
+			return err
 		}
+		remaining = remaining.Sub(lot.Quantity)
 
 		sale := &Sale{
-			Asset:        h.Asset,
-			FifoCost:     cost,
-			Proceeds:     proceeds,
-			Quantity:     quantity.Sub(remaining),
-			SaleDate:     date,
-			PurchaseDate: lot.PurchaseDate,
+			Asset:    h.Asset,
+			Proceeds: lot.Quantity.Mul(spot).Sub(share(fee, lot.Quantity, quantity)),
+			Quantity: lot.Quantity,
+			SaleDate: date,
+			Currency: lot.Currency,
 		}
+		sale.FifoCost, sale.PurchaseDate = lot.basis(sale.Proceeds)
+		sale.HoldingSince = lot.HoldingSince
+		sale.OriginalCost, sale.CostCurrency = lot.OriginalCost()
+		sale.OriginalProceeds, sale.ProceedsCurrency = sale.Proceeds, sale.Currency
 		sales <- sale
 
 	}
 	return nil
 }
 
+// Withdraw removes quantity shares from the LotHistory, returning the lots
+// they came from with their original purchase dates and basis
+func (h *LotHistory) Withdraw(quantity decimal.Decimal, date time.Time) ([]*Lot, error) {
+	lots := make([]*Lot, 0)
+
+	if quantity.LessThanOrEqual(decimal.Zero) {
+		return lots, &NegativeQuantityErr{}
+	}
+
+	if h.Quantity().LessThan(quantity) {
+		return lots, fmt.Errorf("Cannot withdraw %s %s, only %s held", quantity, h.Asset, h.Quantity())
+	}
+
+	remaining := quantity
+	for remaining.GreaterThan(decimal.Zero) {
+		lot, err := h.split(h.method().Next(h.Lots, date), remaining)
+		if err != nil {
+			return lots, err
+		}
+		remaining = remaining.Sub(lot.Quantity)
+		lots = append(lots, lot)
+	}
+	return lots, nil
+}
+
+// Deposit adds previously withdrawn lots back to the LotHistory, keeping the
+// lots ordered by purchase date
+func (h *LotHistory) Deposit(lots []*Lot) {
+	h.Lots = append(h.Lots, lots...)
+	sort.SliceStable(h.Lots, func(i, j int) bool {
+		return h.Lots[i].PurchaseDate.Before(h.Lots[j].PurchaseDate)
+	})
+}
+
+// Flush is a no-op, a LotHistory sends its Sales as soon as they occur
+func (h *LotHistory) Flush(sales chan<- *Sale) error {
+	return nil
+}
+
 // Quantity returns the total number of shares in the LotHistory
 func (h *LotHistory) Quantity() decimal.Decimal {
 	quantity := decimal.Zero
@@ -190,47 +544,611 @@ func (h *LotHistory) Quantity() decimal.Decimal {
 func (h *LotHistory) TotalCost() decimal.Decimal {
 	totalCost := decimal.Zero
 	for _, l := range h.Lots {
-		totalCost = totalCost.Add(l.Spot.Mul(l.Quantity))
+		totalCost = totalCost.Add(l.TotalCost())
 	}
 	return totalCost
 }
 
+// share returns the part of amount attributable to part of quantity
+func share(amount, part, quantity decimal.Decimal) decimal.Decimal {
+	if amount.IsZero() || quantity.IsZero() {
+		return decimal.Zero
+	}
+	if part.Equal(quantity) {
+		return amount
+	}
+	return amount.Mul(part).Div(quantity)
+}
+
+// Term is the holding period of a sale
+type Term int
+
+const (
+	// SHORT_TERM is a sale of crypto held for one year or less
+	SHORT_TERM Term = iota
+	// LONG_TERM is a sale of crypto held for more than one year
+	LONG_TERM Term = iota
+	// POOLED is a sale matched against a pool, which has no holding period
+	POOLED Term = iota
+)
+
+func (t Term) String() string {
+	switch t {
+	case LONG_TERM:
+		return "long-term"
+	case POOLED:
+		return "pooled"
+	}
+	return "short-term"
+}
+
+// LongTermDate returns the first day on which crypto purchased on the given
+// date can be sold as a long-term sale.  The holding period starts the day
+// after the purchase, so that is the day after the one-year anniversary.
+// Purchases on February 29 have their anniversary on February 28.
+func LongTermDate(purchased time.Time) time.Time {
+	y, m, d := purchased.UTC().Date()
+	if m == time.February && d == 29 {
+		d = 28
+	}
+	return time.Date(y+1, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+}
+
 // Sale is a taxable sale event
 type Sale struct {
-	Asset        string
+	Asset string
+	// Currency is the currency of the amounts of the sale
+	Currency     string
 	SaleDate     time.Time
 	PurchaseDate time.Time
 	Quantity     decimal.Decimal
-	FifoCost     decimal.Decimal
-	Proceeds     decimal.Decimal
+	// FifoCost is the cost basis of the lot sold, whichever
+	// LotSelectionMethod picked it
+	FifoCost       decimal.Decimal
+	Proceeds       decimal.Decimal
+	DisallowedLoss decimal.Decimal
+	// Pooled is set when the sale was matched against a pooled holding
+	// rather than a lot, even when a matching rule gave it a PurchaseDate
+	Pooled bool
+	// HoldingSince is when the holding period of shares that replaced
+	// others in a wash sale began, or zero when it began on PurchaseDate
+	HoldingSince time.Time
+
+	// OriginalCost is the cost basis in CostCurrency, the currency the lot
+	// was bought in, and OriginalProceeds the proceeds in ProceedsCurrency,
+	// the currency it was sold in, before they were converted to Currency.
+	// They are zero for pooled sales, whose cost is averaged over every
+	// acquisition.
+	OriginalCost     decimal.Decimal
+	CostCurrency     string
+	OriginalProceeds decimal.Decimal
+	ProceedsCurrency string
+}
+
+// holdingSince returns when the holding period of the shares sold began
+func (s Sale) holdingSince() time.Time {
+	if s.HoldingSince.IsZero() {
+		return s.PurchaseDate
+	}
+	return s.HoldingSince
+}
+
+// Term returns the holding period of the sale, or POOLED for a sale
+// matched against a pool
+func (s Sale) Term() Term {
+	if s.Pooled {
+		return POOLED
+	}
+	if day(s.SaleDate).Before(LongTermDate(s.holdingSince())) {
+		return SHORT_TERM
+	}
+	return LONG_TERM
+}
+
+// Gain returns the realized gain (or loss if negative) of the sale, after
+// adding back any disallowed loss
+func (s Sale) Gain() decimal.Decimal {
+	return s.Proceeds.Sub(s.FifoCost).Add(s.DisallowedLoss)
+}
+
+// Gift is crypto given away, which is not a taxable sale but counts towards
+// gift tax thresholds.  Spot is the price on the Date of the gift, in
+// Currency.  Lots are the lots given, whose basis and purchase dates the
+// Recipient takes on, and are empty for gifts from a pool.
+type Gift struct {
+	Asset     string
+	Recipient string
+	Date      time.Time
+	Quantity  decimal.Decimal
+	Spot      decimal.Decimal
+	Currency  string
+	Lots      []*Lot
 }
 
-// Account is a Coinbase account, containing a LotHistory per crypto asset
+// Value is the fair market value of the gift when given
+func (g Gift) Value() decimal.Decimal {
+	return g.Quantity.Mul(g.Spot)
+}
+
+// Basis is the cost basis of the lots given
+func (g Gift) Basis() decimal.Decimal {
+	basis := decimal.Zero
+	for _, l := range g.Lots {
+		basis = basis.Add(l.TotalCost())
+	}
+	return basis
+}
+
+// Income is crypto received as ordinary income, valued at its fair market
+// value in Currency when received
+type Income struct {
+	Asset    string
+	Date     time.Time
+	Quantity decimal.Decimal
+	Spot     decimal.Decimal
+	Currency string
+}
+
+// Value is the fair market value of the income when received
+func (i Income) Value() decimal.Decimal {
+	return i.Quantity.Mul(i.Spot)
+}
+
+// Account is a Coinbase account, containing a Holding per crypto asset
 type Account struct {
-	Holdings map[string]*LotHistory
+	// Currency is the currency of every transaction in the account, set by
+	// the first transaction processed when empty
+	Currency string
+	Holdings map[string]Holding
+	// Model determines which kind of Holding is used
+	Model BasisModel
+	// Method is the LotSelectionMethod used by LOTS holdings for every
+	// asset without an entry in AssetMethods, defaulting to FIFO when nil
+	Method       LotSelectionMethod
+	AssetMethods map[string]LotSelectionMethod
+	// InTransit holds the lots transferred out of the account that have not
+	// been received back yet
+	InTransit map[string]*LotHistory
+	// Prices, when set, values the transactions that have no spot price
+	Prices prices.Source
+	// Rates, when set, converts the transactions in other currencies to
+	// Currency
+	Rates prices.Source
+	// WashSales simulates the US wash sale rule for LOTS holdings
+	WashSales bool
+	// Gifts are the gifts given, in the order they were processed
+	Gifts []*Gift
+
+	// held are the Sales held until the account is flushed, and losses the
+	// losses among them that replacement shares may still disallow
+	held   []*Sale
+	losses []*washLoss
+
+	// sent is the quantity of each pooled asset transferred out that has not
+	// been received back yet
+	sent map[string]decimal.Decimal
+}
+
+// lotHolder is a Holding whose lots move with the shares when they are
+// transferred between wallets
+type lotHolder interface {
+	Holding
+	Withdraw(quantity decimal.Decimal, date time.Time) ([]*Lot, error)
+	Deposit(lots []*Lot)
 }
 
 // NewAccount initializes an Account struct
 func NewAccount() *Account {
 	return &Account{
-		Holdings: make(map[string]*LotHistory),
+		Holdings:     make(map[string]Holding),
+		AssetMethods: make(map[string]LotSelectionMethod),
+		InTransit:    make(map[string]*LotHistory),
+		sent:         make(map[string]decimal.Decimal),
 	}
 }
 
-// ProcessTransaction replays a transaction in the account, sending any resulting
-// Sales to the sales channel
-func (a *Account) ProcessTransaction(t *Transaction, sales chan<- *Sale) error {
+func (a *Account) newHolding(asset string) Holding {
+	switch a.Model {
+	case SECTION_104:
+		return NewSection104Pool(asset)
+	case ADJUSTED_COST_BASE:
+		return NewAdjustedCostBasePool(asset)
+	}
 
-	asset := t.Asset
+	method, ok := a.AssetMethods[asset]
+	if !ok {
+		method = a.Method
+	}
+	if designations, ok := method.(SpecificIdentification); ok {
+		method = designations.forAsset(asset)
+	}
+	return &LotHistory{
+		Asset:  asset,
+		Lots:   make([]*Lot, 0),
+		Method: method,
+	}
+}
+
+func (a *Account) holding(asset string) Holding {
 	holding, ok := a.Holdings[asset]
 	if !ok {
-		holding = &LotHistory{
-			Asset: t.Asset,
+		holding = a.newHolding(asset)
+		a.Holdings[asset] = holding
+	}
+	return holding
+}
+
+// convert processes both legs of a CONVERT, leaving the account unchanged
+// if either leg is invalid
+func (a *Account) convert(t *Transaction, sales chan<- *Sale) error {
+	sell, buy := t.Legs()
+
+	if sell.Quantity.LessThanOrEqual(decimal.Zero) {
+		return &NegativeQuantityErr{}
+	}
+	if sell.Spot.LessThanOrEqual(decimal.Zero) {
+		return &NegativeSpotErr{}
+	}
+	if sell.Fee.LessThan(decimal.Zero) {
+		return &NegativeFeeErr{}
+	}
+	if buy.Asset == "" || buy.Asset == sell.Asset {
+		return fmt.Errorf("Invalid conversion of %s to '%s'", sell.Asset, buy.Asset)
+	}
+
+	source := a.holding(sell.Asset)
+	if source.Quantity().LessThan(sell.Quantity) {
+		return fmt.Errorf("Cannot convert %s %s, only %s held", sell.Quantity, sell.Asset, source.Quantity())
+	}
+
+	// A failed buy leaves the target untouched, and the sell has been
+	// validated above, so the swap is applied as a whole or not at all
+	if err := a.holding(buy.Asset).Buy(buy.ToLot()); err != nil {
+		return err
+	}
+	return source.Sell(sell.Quantity, sell.Spot, sell.Fee, sell.Timestamp, sales)
+}
+
+func (a *Account) inTransit(asset string) *LotHistory {
+	transit, ok := a.InTransit[asset]
+	if !ok {
+		transit = &LotHistory{
+			Asset: asset,
 			Lots:  make([]*Lot, 0),
 		}
-		a.Holdings[asset] = holding
+		a.InTransit[asset] = transit
+	}
+	return transit
+}
+
+// transferOut moves lots out of a holding until they are received by a
+// TRANSFER_IN.  Pooled holdings span every wallet, so they are unchanged by
+// transfers, and only the quantity sent is kept to match it when received.
+func (a *Account) transferOut(t *Transaction, holding Holding) error {
+	holder, ok := holding.(lotHolder)
+	if !ok {
+		if a.sent == nil {
+			a.sent = make(map[string]decimal.Decimal)
+		}
+		a.sent[t.Asset] = a.sent[t.Asset].Add(t.Quantity)
+		return nil
+	}
+
+	lots, err := holder.Withdraw(t.Quantity, t.Timestamp)
+	if err != nil {
+		return err
+	}
+	a.inTransit(t.Asset).Deposit(lots)
+	return nil
+}
+
+// transferIn moves lots in transit back into a holding, keeping their
+// original purchase dates and basis.  Shares received without a matching
+// TRANSFER_OUT are treated as acquired at the spot price.
+func (a *Account) transferIn(t *Transaction, holding Holding) error {
+	if t.Quantity.LessThanOrEqual(decimal.Zero) {
+		return &NegativeQuantityErr{}
+	}
+
+	holder, ok := holding.(lotHolder)
+	pending := a.sent[t.Asset]
+	if ok {
+		pending = a.inTransit(t.Asset).Quantity()
+	}
+	received := decimal.Min(t.Quantity, pending)
+	remaining := t.Quantity.Sub(received)
+	if remaining.GreaterThan(decimal.Zero) && t.Spot.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("Received %s %s more than was transferred out, with no spot price to value it", remaining, t.Asset)
+	}
+
+	if received.GreaterThan(decimal.Zero) {
+		if !ok {
+			a.sent[t.Asset] = pending.Sub(received)
+		} else {
+			lots, err := a.inTransit(t.Asset).Withdraw(received, t.Timestamp)
+			if err != nil {
+				return err
+			}
+			holder.Deposit(lots)
+		}
+	}
+
+	if remaining.GreaterThan(decimal.Zero) {
+		lot := t.ToLot()
+		lot.Quantity, lot.Fees = remaining, decimal.Zero
+		return holding.Buy(lot)
+	}
+	return nil
+}
+
+// giftIn adds shares received as a gift, which keep the donor's basis and
+// acquisition date.  Pooled holdings don't carry over the donor's basis, so
+// the shares join the pool at their market value on the day of the gift, as
+// under the UK and Canadian rules.
+func (a *Account) giftIn(t *Transaction, holding Holding) error {
+	if t.Quantity.LessThanOrEqual(decimal.Zero) {
+		return &NegativeQuantityErr{}
+	}
+	if t.Spot.LessThanOrEqual(decimal.Zero) {
+		return &NegativeSpotErr{}
+	}
+	value := t.Quantity.Mul(t.Spot)
+
+	holder, ok := holding.(lotHolder)
+	if !ok {
+		lot := costLot(t.Timestamp, t.Quantity, value, t.Currency)
+		lot.OriginalCurrency, lot.Rate = t.OriginalCurrency, t.Rate
+		return holding.Buy(lot)
+	}
+
+	if t.DonorBasis.LessThanOrEqual(decimal.Zero) {
+		return fmt.Errorf("Gift of %s %s on %s has no donor basis", t.Quantity, t.Asset, t.Timestamp.Format("2006-01-02"))
+	}
+	acquired := t.DonorAcquired
+	if acquired.IsZero() || acquired.After(t.Timestamp) {
+		acquired = t.Timestamp
+	}
+	lot := costLot(acquired, t.Quantity, t.DonorBasis, t.Currency)
+	lot.OriginalCurrency, lot.Rate = t.OriginalCurrency, t.Rate
+	if value.LessThan(t.DonorBasis) {
+		lot.GiftDate, lot.GiftValue = t.Timestamp, value
+	}
+	holder.Deposit([]*Lot{lot})
+	return nil
+}
+
+// giftOut removes the shares given away without a sale, recording the Gift.
+// Pooled holdings have no lots to give, so a gift from a pool is a disposal
+// at its market value, as under the UK and Canadian rules.
+func (a *Account) giftOut(t *Transaction, holding Holding, sales chan<- *Sale) error {
+	gift := &Gift{
+		Asset:     t.Asset,
+		Recipient: t.Counterparty,
+		Date:      t.Timestamp,
+		Quantity:  t.Quantity,
+		Spot:      t.Spot,
+		Currency:  t.Currency,
+	}
+
+	holder, ok := holding.(lotHolder)
+	if !ok {
+		if err := holding.Sell(t.Quantity, t.Spot, t.Fee, t.Timestamp, sales); err != nil {
+			return err
+		}
+	} else {
+		lots, err := holder.Withdraw(t.Quantity, t.Timestamp)
+		if err != nil {
+			return err
+		}
+		gift.Lots = lots
+	}
+
+	a.Gifts = append(a.Gifts, gift)
+	return nil
+}
+
+// checkFee validates the fee paid in FeeAsset, including that enough of
+// FeeAsset will be held to pay it once the transaction itself is processed
+func (a *Account) checkFee(t *Transaction) error {
+	if t.FeeQuantity.LessThanOrEqual(decimal.Zero) {
+		return &NegativeQuantityErr{}
+	}
+	if t.FeeSpot.IsZero() {
+		return &MissingPriceErr{Asset: t.FeeAsset, Time: t.Timestamp}
+	}
+	if t.FeeSpot.LessThan(decimal.Zero) {
+		return &NegativeSpotErr{}
+	}
+
+	available := a.holding(t.FeeAsset).Quantity()
+	if t.Asset == t.FeeAsset {
+		switch t.Action {
+		case BUY, INCOME, TRANSFER_IN, GIFT_IN:
+			available = available.Add(t.Quantity)
+		default:
+			available = available.Sub(t.Quantity)
+		}
+	}
+	if t.Action == CONVERT && t.ToAsset == t.FeeAsset {
+		available = available.Add(t.ToQuantity)
+	}
+
+	if available.LessThan(t.FeeQuantity) {
+		return fmt.Errorf("Cannot pay a fee of %s %s, only %s held", t.FeeQuantity, t.FeeAsset, a.holding(t.FeeAsset).Quantity())
+	}
+	return nil
+}
+
+// price returns a copy of a transaction with the spot prices it is missing
+// found in Prices, in the currency of the transaction or the account.  A
+// transaction with no currency of its own that has no price in the
+// account's currency is priced in prices.DefaultCurrency instead when Rates
+// can convert it.  Transfers only need a price for shares received without
+// a matching TRANSFER_OUT, and gifts given only for reporting their value,
+// so their missing price is not an error.
+func (a *Account) price(t *Transaction) (*Transaction, error) {
+	missingSpot := t.Spot.IsZero() && t.Action != TRANSFER_OUT
+	missingFee := t.FeeAsset != "" && t.FeeSpot.IsZero()
+	if a.Prices == nil || (!missingSpot && !missingFee) {
+		return t, nil
+	}
+
+	currency := t.Currency
+	if currency == "" {
+		currency = a.Currency
+	}
+	if currency == "" {
+		currency = prices.DefaultCurrency
+	}
+
+	priced := *t
+	lookup := func(asset string) (decimal.Decimal, error) {
+		spot, err := a.Prices.Price(asset, currency, t.Timestamp)
+		// A spot already set is in the account's currency, so only a
+		// transaction priced entirely from Prices can fall back
+		if err != nil && t.Currency == "" && a.Rates != nil && currency != prices.DefaultCurrency && priced.Spot.IsZero() {
+			if fallback, ferr := a.Prices.Price(asset, prices.DefaultCurrency, t.Timestamp); ferr == nil {
+				spot, err, currency = fallback, nil, prices.DefaultCurrency
+			}
+		}
+		return spot, err
+	}
+
+	if missingSpot {
+		spot, err := lookup(t.Asset)
+		if err != nil && t.Action != TRANSFER_IN && t.Action != GIFT_OUT {
+			return t, err
+		}
+		if err == nil {
+			priced.Spot, priced.Currency = spot, currency
+		}
+	}
+	if missingFee {
+		spot, err := lookup(t.FeeAsset)
+		if err != nil {
+			return t, err
+		}
+		priced.FeeSpot, priced.Currency = spot, currency
+	}
+	return &priced, nil
+}
+
+// exchange returns a copy of a transaction with its amounts converted to the
+// currency of the account, at the rate on the day of the transaction
+func (a *Account) exchange(t *Transaction) (*Transaction, error) {
+	rate, err := a.Rates.Price(t.Currency, a.Currency, t.Timestamp)
+	if err != nil {
+		return t, err
+	}
+
+	converted := *t
+	converted.Spot = t.Spot.Mul(rate)
+	converted.Fee = t.Fee.Mul(rate)
+	converted.FeeSpot = t.FeeSpot.Mul(rate)
+	converted.DonorBasis = t.DonorBasis.Mul(rate)
+	converted.Currency = a.Currency
+	converted.OriginalCurrency = t.Currency
+	converted.Rate = rate
+	return &converted, nil
+}
+
+// intercept returns a channel that passes every Sale sent to it to f.  The
+// returned func must be called once every Sale is sent.
+func intercept(f func(*Sale)) (chan<- *Sale, func()) {
+	sales := make(chan *Sale)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for s := range sales {
+			f(s)
+		}
+	}()
+	return sales, func() {
+		close(sales)
+		<-done
+	}
+}
+
+// ProcessTransaction replays a transaction in the account, sending any resulting
+// Sales to the sales channel and Income to the income channel.  income may be
+// nil if Income events are not needed.  A fee paid in FeeAsset is disposed
+// of at FeeSpot, and its value added to the Fee of the transaction.  Spot
+// prices missing from the transaction are found in Prices, if set, and
+// amounts in another currency are converted to the account's Currency
+// with Rates, if set.  When WashSales is set, Sales are held until the
+// account is flushed.
+func (a *Account) ProcessTransaction(t *Transaction, sales chan<- *Sale, income chan<- *Income) error {
+	if !a.WashSales {
+		return a.processTransaction(t, sales, income)
+	}
+
+	// A loss is disallowed by replacement shares bought up to 30 days after
+	// it, so Sales are only sent once every transaction is processed
+	held, done := intercept(a.hold)
+	err := a.processTransaction(t, held, income)
+	done()
+	if err != nil {
+		return err
+	}
+	return a.washSales(t.Timestamp)
+}
+
+func (a *Account) processTransaction(t *Transaction, sales chan<- *Sale, income chan<- *Income) error {
+	t, err := a.price(t)
+	if err != nil {
+		return err
+	}
+	if t.Spot.IsZero() && needsSpot(t.Action) {
+		return &MissingPriceErr{Asset: t.Asset, Time: t.Timestamp}
 	}
 
+	if t.Currency != "" {
+		if a.Currency == "" {
+			a.Currency = t.Currency
+		}
+		if t.Currency != a.Currency {
+			if a.Rates == nil {
+				return &CurrencyMismatchErr{Expected: a.Currency, Found: t.Currency}
+			}
+			t, err = a.exchange(t)
+			if err != nil {
+				return err
+			}
+			if sales != nil {
+				out, converted := sales, t
+				var done func()
+				sales, done = intercept(func(s *Sale) {
+					s.OriginalProceeds, s.ProceedsCurrency = s.Proceeds.Div(converted.Rate), converted.OriginalCurrency
+					out <- s
+				})
+				defer done()
+			}
+		}
+	}
+
+	if t.FeeAsset == "" {
+		return a.process(t, sales, income)
+	}
+
+	if err := a.checkFee(t); err != nil {
+		return err
+	}
+	paid := *t
+	paid.Fee = t.Fee.Add(t.FeeValue())
+	paid.FeeAsset = ""
+	if err := a.process(&paid, sales, income); err != nil {
+		return err
+	}
+	return a.holding(t.FeeAsset).Sell(t.FeeQuantity, t.FeeSpot, decimal.Zero, t.Timestamp, sales)
+}
+
+func (a *Account) process(t *Transaction, sales chan<- *Sale, income chan<- *Income) error {
+	if t.Action == CONVERT {
+		return a.convert(t, sales)
+	}
+
+	holding := a.holding(t.Asset)
+
 	switch t.Action {
 	case BUY:
 		lot := t.ToLot()
@@ -240,10 +1158,62 @@ func (a *Account) ProcessTransaction(t *Transaction, sales chan<- *Sale) error {
 		}
 
 	case SELL:
-		err := holding.Sell(t.Quantity, t.Spot, t.Timestamp, sales)
+		err := holding.Sell(t.Quantity, t.Spot, t.Fee, t.Timestamp, sales)
 		if err != nil {
 			return err
 		}
+
+	case TRANSFER_OUT:
+		return a.transferOut(t, holding)
+
+	case TRANSFER_IN:
+		return a.transferIn(t, holding)
+
+	case GIFT_IN:
+		return a.giftIn(t, holding)
+
+	case GIFT_OUT:
+		return a.giftOut(t, holding, sales)
+
+	case INCOME:
+		// Income is a new lot with a basis of its fair market value
+		err := holding.Buy(t.ToLot())
+		if err != nil {
+			return err
+		}
+
+		if income != nil {
+			income <- &Income{
+				Asset:    t.Asset,
+				Date:     t.Timestamp,
+				Quantity: t.Quantity,
+				Spot:     t.Spot,
+				Currency: t.Currency,
+			}
+		}
+	}
+	return nil
+}
+
+// Flush sends the Sales held for the wash sale rule, and those deferred by
+// pooled holdings, to the sales channel.  It should be called once every
+// transaction has been processed.
+func (a *Account) Flush(sales chan<- *Sale) error {
+	for _, s := range a.held {
+		sales <- s
+	}
+	a.held, a.losses = nil, nil
+
+	assets := make([]string, 0, len(a.Holdings))
+	for asset := range a.Holdings {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	for _, asset := range assets {
+		if err := a.Holdings[asset].Flush(sales); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -256,5 +1226,10 @@ func (a *Account) Report() string {
 	for asset, holding := range a.Holdings {
 		report += fmt.Sprintf("%s: %s\n", asset, holding.Quantity())
 	}
+	for asset, transit := range a.InTransit {
+		if transit.Quantity().GreaterThan(decimal.Zero) {
+			report += fmt.Sprintf("%s (in transit): %s\n", asset, transit.Quantity())
+		}
+	}
 	return report
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/shopspring/decimal"
+	"github.com/sklarsa/crypto-taxes/prices"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -96,7 +97,7 @@ func TestBasicLotHistoryUsage(t *testing.T) {
 			case BUY:
 				h.Buy(t.ToLot())
 			case SELL:
-				h.Sell(t.Quantity, t.Spot, t.Timestamp, sales)
+				h.Sell(t.Quantity, t.Spot, t.Fee, t.Timestamp, sales)
 			}
 		}
 	}()
@@ -153,7 +154,7 @@ func TestLotHistoryEdgeCases(t *testing.T) {
 	sales := make(chan *Sale)
 
 	// Cannot sell with no lots
-	err := h.Sell(quantity, price, t0, nil)
+	err := h.Sell(quantity, price, decimal.Zero, t0, nil)
 	assert.Error(t, err)
 
 	// Cannot sell more shares than bought
@@ -164,7 +165,7 @@ func TestLotHistoryEdgeCases(t *testing.T) {
 	})
 
 	go func() {
-		err = h.Sell(quantity.Add(decimal.NewFromInt(1000)), price, t1, sales)
+		err = h.Sell(quantity.Add(decimal.NewFromInt(1000)), price, decimal.Zero, t1, sales)
 		assert.Error(t, err)
 	}()
 	sale := <-sales
@@ -185,3 +186,505 @@ func TestLotHistoryEdgeCases(t *testing.T) {
 	})
 	assert.Error(t, err)
 }
+
+func TestLotHistoryFees(t *testing.T) {
+	h := &LotHistory{
+		Asset: "BTC",
+		Lots:  make([]*Lot, 0),
+	}
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h.Buy(&Lot{
+		PurchaseDate: t0,
+		Quantity:     decimal.NewFromInt(100),
+		Spot:         decimal.NewFromInt(1),
+		Fees:         decimal.NewFromInt(10),
+	})
+	h.Buy(&Lot{
+		PurchaseDate: t0.AddDate(0, 0, 1),
+		Quantity:     decimal.NewFromInt(100),
+		Spot:         decimal.NewFromInt(2),
+		Fees:         decimal.NewFromInt(20),
+	})
+	assert.Equal(t, "330", h.TotalCost().String())
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		err := h.Sell(decimal.NewFromInt(150), decimal.NewFromInt(3), decimal.NewFromInt(15), t0.AddDate(0, 0, 2), sales)
+		assert.Nil(t, err)
+	}()
+
+	// Buy fees are capitalized into the cost and the sell fee is split
+	// pro-rata between the two lots
+	sale := <-sales
+	assert.Equal(t, "100", sale.Quantity.String())
+	assert.Equal(t, "110", sale.FifoCost.String())
+	assert.Equal(t, "290", sale.Proceeds.String())
+
+	sale = <-sales
+	assert.Equal(t, "50", sale.Quantity.String())
+	assert.Equal(t, "110", sale.FifoCost.String())
+	assert.Equal(t, "145", sale.Proceeds.String())
+
+	assert.Equal(t, "110", h.TotalCost().String())
+
+	assert.Error(t, h.Sell(decimal.NewFromInt(1), decimal.NewFromInt(3), decimal.NewFromInt(-1), t0.AddDate(0, 0, 3), nil))
+}
+
+func TestAccountConvert(t *testing.T) {
+	account := NewAccount()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	convert := &Transaction{
+		Timestamp:  t0.AddDate(0, 0, 1),
+		Action:     CONVERT,
+		Asset:      "ETH",
+		Quantity:   decimal.NewFromFloat(0.5),
+		Spot:       decimal.NewFromInt(200),
+		Fee:        decimal.NewFromInt(10),
+		ToAsset:    "LINK",
+		ToQuantity: decimal.NewFromInt(20),
+	}
+
+	// Converting more than is held leaves both assets untouched
+	err := account.ProcessTransaction(convert, nil, nil)
+	assert.Error(t, err)
+	assert.True(t, account.Holdings["ETH"].Quantity().IsZero())
+	_, ok := account.Holdings["LINK"]
+	assert.False(t, ok)
+
+	err = account.ProcessTransaction(&Transaction{
+		Timestamp: t0,
+		Action:    BUY,
+		Asset:     "ETH",
+		Quantity:  decimal.NewFromInt(1),
+		Spot:      decimal.NewFromInt(100),
+	}, nil, nil)
+	assert.Nil(t, err)
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		err := account.ProcessTransaction(convert, sales, nil)
+		assert.Nil(t, err)
+	}()
+
+	sale := <-sales
+	assert.Equal(t, "ETH", sale.Asset)
+	assert.Equal(t, "50", sale.FifoCost.String())
+	assert.Equal(t, "90", sale.Proceeds.String())
+	for range sales {
+		t.Errorf("Too many sales!")
+	}
+
+	// The asset received is valued at the net proceeds
+	link := account.Holdings["LINK"]
+	assert.Equal(t, "20", link.Quantity().String())
+	assert.Equal(t, "90", link.TotalCost().String())
+	assert.Equal(t, "0.5", account.Holdings["ETH"].Quantity().String())
+}
+
+func TestAccountFeeAsset(t *testing.T) {
+	account := NewAccount()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	buy := &Transaction{
+		Timestamp:   t0.AddDate(0, 0, 1),
+		Action:      BUY,
+		Asset:       "BTC",
+		Quantity:    decimal.NewFromInt(1),
+		Spot:        decimal.NewFromInt(100),
+		FeeAsset:    "BNB",
+		FeeQuantity: decimal.NewFromInt(2),
+		FeeSpot:     decimal.NewFromInt(5),
+	}
+
+	// A fee that cannot be paid leaves the account untouched
+	err := account.ProcessTransaction(buy, nil, nil)
+	assert.Error(t, err)
+	_, ok := account.Holdings["BTC"]
+	assert.False(t, ok)
+
+	err = account.ProcessTransaction(&Transaction{
+		Timestamp: t0,
+		Action:    BUY,
+		Asset:     "BNB",
+		Quantity:  decimal.NewFromInt(10),
+		Spot:      decimal.NewFromInt(1),
+	}, nil, nil)
+	assert.Nil(t, err)
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		err := account.ProcessTransaction(buy, sales, nil)
+		assert.Nil(t, err)
+	}()
+
+	// Paying the fee disposes of the BNB at its fair market value
+	sale := <-sales
+	assert.Equal(t, "BNB", sale.Asset)
+	assert.Equal(t, "2", sale.Quantity.String())
+	assert.Equal(t, "2", sale.FifoCost.String())
+	assert.Equal(t, "10", sale.Proceeds.String())
+	for range sales {
+		t.Errorf("Too many sales!")
+	}
+
+	// and its value is capitalized into the lot bought
+	assert.Equal(t, "110", account.Holdings["BTC"].TotalCost().String())
+	assert.Equal(t, "8", account.Holdings["BNB"].Quantity().String())
+}
+
+func TestAccountTransfers(t *testing.T) {
+	account := NewAccount()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	transactions := []*Transaction{
+		{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(100)},
+		{Timestamp: t0.AddDate(0, 0, 1), Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(200)},
+		{Timestamp: t0.AddDate(0, 0, 2), Action: TRANSFER_OUT, Asset: "BTC", Quantity: decimal.NewFromFloat(1.5), Spot: decimal.NewFromInt(250)},
+	}
+	for _, tr := range transactions {
+		// Transfers never realize a gain, so no sales channel is needed
+		assert.Nil(t, account.ProcessTransaction(tr, nil, nil))
+	}
+
+	assert.Equal(t, "0.5", account.Holdings["BTC"].Quantity().String())
+	assert.Equal(t, "1.5", account.InTransit["BTC"].Quantity().String())
+	assert.Equal(t, "200", account.InTransit["BTC"].TotalCost().String())
+
+	// Cannot transfer out more than is held
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 3), Action: TRANSFER_OUT, Asset: "BTC", Quantity: decimal.NewFromInt(1)}, nil, nil)
+	assert.Error(t, err)
+
+	// The lots in transit come back with their original purchase dates, and
+	// the extra 0.5 received is acquired at the spot price
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 3), Action: TRANSFER_IN, Asset: "BTC", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(300)}, nil, nil)
+	assert.Nil(t, err)
+
+	h := account.Holdings["BTC"].(*LotHistory)
+	assert.Equal(t, "2.5", h.Quantity().String())
+	assert.Equal(t, "450", h.TotalCost().String())
+	assert.Equal(t, t0, h.Lots[0].PurchaseDate)
+	assert.Equal(t, t0.AddDate(0, 0, 3), h.tail().PurchaseDate)
+	assert.True(t, account.InTransit["BTC"].Quantity().IsZero())
+}
+
+func TestAccountIncome(t *testing.T) {
+	account := NewAccount()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	income := make(chan *Income)
+	go func() {
+		defer close(income)
+		err := account.ProcessTransaction(&Transaction{
+			Timestamp: t0,
+			Action:    INCOME,
+			Asset:     "XLM",
+			Quantity:  decimal.NewFromInt(50),
+			Spot:      decimal.NewFromFloat(0.1),
+		}, nil, income)
+		assert.Nil(t, err)
+	}()
+
+	i := <-income
+	assert.Equal(t, "XLM", i.Asset)
+	assert.Equal(t, t0, i.Date)
+	assert.Equal(t, "5", i.Value().String())
+
+	// The income is held as a lot at its fair market value
+	assert.Equal(t, "50", account.Holdings["XLM"].Quantity().String())
+	assert.Equal(t, "5", account.Holdings["XLM"].TotalCost().String())
+}
+
+func TestSaleTerm(t *testing.T) {
+	tests := []struct {
+		purchased string
+		sold      string
+		term      Term
+	}{
+		{"2020-01-01T10:00:00Z", "2020-12-31T10:00:00Z", SHORT_TERM},
+		// Held for exactly one year
+		{"2020-01-01T10:00:00Z", "2021-01-01T23:00:00Z", SHORT_TERM},
+		{"2020-01-01T10:00:00Z", "2021-01-02T00:00:00Z", LONG_TERM},
+		// Leap day purchases have their anniversary on February 28
+		{"2020-02-29T10:00:00Z", "2021-02-28T10:00:00Z", SHORT_TERM},
+		{"2020-02-29T10:00:00Z", "2021-03-01T10:00:00Z", LONG_TERM},
+		// The anniversary of a purchase before a leap day is unaffected
+		{"2019-03-01T10:00:00Z", "2020-03-01T10:00:00Z", SHORT_TERM},
+		{"2019-03-01T10:00:00Z", "2020-03-02T10:00:00Z", LONG_TERM},
+		{"2019-02-28T10:00:00Z", "2020-02-29T10:00:00Z", LONG_TERM},
+	}
+
+	for _, tt := range tests {
+		purchased, _ := time.Parse(time.RFC3339, tt.purchased)
+		sold, _ := time.Parse(time.RFC3339, tt.sold)
+		s := Sale{PurchaseDate: purchased, SaleDate: sold}
+		assert.Equal(t, tt.term, s.Term(), "purchased %s, sold %s", tt.purchased, tt.sold)
+	}
+
+	// Sales matched against a pool are pooled even when a matching rule
+	// gave them a purchase date
+	s := Sale{SaleDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), Pooled: true}
+	assert.Equal(t, POOLED, s.Term())
+	s.PurchaseDate = s.SaleDate
+	assert.Equal(t, POOLED, s.Term())
+}
+
+func TestAccountCurrency(t *testing.T) {
+	account := NewAccount()
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(100), Currency: "EUR"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "EUR", account.Currency)
+	assert.Equal(t, "EUR", account.Holdings["BTC"].(*LotHistory).Lots[0].Currency)
+
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(100), Currency: "USD"}, nil, nil)
+	assert.IsType(t, &CurrencyMismatchErr{}, err)
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: SELL, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(150), Currency: "EUR"}, sales, nil)
+		assert.Nil(t, err)
+	}()
+	sale := <-sales
+	assert.Equal(t, "EUR", sale.Currency)
+}
+
+func TestAccountPrices(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	files := prices.NewFiles()
+	files.Add("BTC", "USD", prices.History{
+		{Time: t0, Price: decimal.NewFromInt(100)},
+		{Time: t0.AddDate(0, 0, 1), Price: decimal.NewFromInt(200)},
+	})
+	files.Add("BNB", "USD", prices.History{
+		{Time: t0, Price: decimal.NewFromInt(10)},
+	})
+
+	account := NewAccount()
+	account.Prices = files
+
+	// Income without a spot price is valued at the price of the day
+	income := make(chan *Income, 1)
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: INCOME, Asset: "BTC", Quantity: decimal.NewFromInt(1)}, nil, income)
+	assert.Nil(t, err)
+	i := <-income
+	assert.Equal(t, "100", i.Spot.String())
+	assert.Equal(t, "USD", i.Currency)
+	assert.Equal(t, "USD", account.Currency)
+
+	// A fee in a third asset is valued too
+	bnb := &Transaction{Timestamp: t0, Action: BUY, Asset: "BNB", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(10)}
+	assert.Nil(t, account.ProcessTransaction(bnb, nil, nil))
+	sales := make(chan *Sale, 2)
+	sell := &Transaction{Timestamp: t0.AddDate(0, 0, 1), Action: SELL, Asset: "BTC", Quantity: decimal.NewFromFloat(0.5), FeeAsset: "BNB", FeeQuantity: decimal.NewFromFloat(0.1)}
+	assert.Nil(t, account.ProcessTransaction(sell, sales, nil))
+	sale := <-sales
+	assert.Equal(t, "99", sale.Proceeds.String())
+	// The transaction itself is left unchanged
+	assert.True(t, sell.Spot.IsZero())
+
+	// Transfers received back don't need a price
+	assert.Nil(t, account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 10), Action: TRANSFER_OUT, Asset: "BTC", Quantity: decimal.NewFromFloat(0.5)}, nil, nil))
+	assert.Nil(t, account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 10), Action: TRANSFER_IN, Asset: "BTC", Quantity: decimal.NewFromFloat(0.5)}, nil, nil))
+
+	// But sales do
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 10), Action: SELL, Asset: "BTC", Quantity: decimal.NewFromFloat(0.5)}, sales, nil)
+	assert.IsType(t, &prices.NoPriceErr{}, err)
+}
+
+func TestAccountRates(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Units of EUR per USD
+	rates := prices.NewFiles()
+	rates.Add("USD", "EUR", prices.History{
+		{Time: t0, Price: decimal.NewFromFloat(0.8)},
+		{Time: t0.AddDate(0, 0, 10), Price: decimal.NewFromFloat(0.9)},
+	})
+
+	account := NewAccount()
+	account.Currency = "EUR"
+	account.Rates = rates
+
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(100), Fee: decimal.NewFromInt(5), Currency: "USD"}, nil, nil)
+	assert.Nil(t, err)
+	lot := account.Holdings["BTC"].(*LotHistory).Lots[0]
+	assert.Equal(t, "EUR", lot.Currency)
+	assert.Equal(t, "164", lot.TotalCost().String())
+
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 5), Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(120), Currency: "EUR"}, nil, nil)
+	assert.Nil(t, err)
+
+	sales := make(chan *Sale, 2)
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 10), Action: SELL, Asset: "BTC", Quantity: decimal.NewFromInt(3), Spot: decimal.NewFromInt(150), Fee: decimal.NewFromInt(3), Currency: "USD"}, sales, nil)
+	assert.Nil(t, err)
+	close(sales)
+
+	// The gain is in EUR, with the cost and proceeds in the currencies the
+	// lot was bought and sold in
+	sale := <-sales
+	assert.Equal(t, "EUR", sale.Currency)
+	assert.Equal(t, "164", sale.FifoCost.String())
+	assert.Equal(t, "268.2", sale.Proceeds.String())
+	assert.Equal(t, "205", sale.OriginalCost.String())
+	assert.Equal(t, "USD", sale.CostCurrency)
+	assert.Equal(t, "298", sale.OriginalProceeds.String())
+	assert.Equal(t, "USD", sale.ProceedsCurrency)
+
+	sale = <-sales
+	assert.Equal(t, "120", sale.OriginalCost.String())
+	assert.Equal(t, "EUR", sale.CostCurrency)
+	assert.Equal(t, "134.1", sale.Proceeds.String())
+	assert.Equal(t, "149", sale.OriginalProceeds.String())
+	assert.Equal(t, "USD", sale.ProceedsCurrency)
+
+	// Without a rate the transaction cannot be converted
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(100), Currency: "GBP"}, nil, nil)
+	assert.IsType(t, &prices.NoPriceErr{}, err)
+}
+
+func TestAccountRatesPrices(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Units of EUR per USD
+	rates := prices.NewFiles()
+	rates.Add("USD", "EUR", prices.History{{Time: t0, Price: decimal.NewFromFloat(0.8)}})
+
+	files := prices.NewFiles()
+	files.Add("BTC", "USD", prices.History{{Time: t0, Price: decimal.NewFromInt(100)}})
+	files.Add("BNB", "USD", prices.History{{Time: t0, Price: decimal.NewFromInt(10)}})
+
+	account := NewAccount()
+	account.Currency = "EUR"
+	account.Rates = rates
+	account.Prices = files
+
+	// A transaction with no currency is priced in dollars when there are
+	// no prices in the account's currency, then converted
+	income := make(chan *Income, 1)
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: INCOME, Asset: "BTC", Quantity: decimal.NewFromInt(1)}, nil, income)
+	assert.Nil(t, err)
+	i := <-income
+	assert.Equal(t, "80", i.Spot.String())
+	assert.Equal(t, "EUR", i.Currency)
+
+	// And so is its fee
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BNB", Quantity: decimal.NewFromInt(1)}, nil, nil)
+	assert.Nil(t, err)
+	sales := make(chan *Sale, 1)
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), FeeAsset: "BNB", FeeQuantity: decimal.NewFromFloat(0.5)}, sales, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "164", account.Holdings["BTC"].TotalCost().String())
+	assert.Equal(t, "4", (<-sales).Proceeds.String())
+
+	// A transaction in euros is not priced in dollars
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Currency: "EUR"}, nil, nil)
+	assert.IsType(t, &prices.NoPriceErr{}, err)
+}
+
+func TestAccountGifts(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	acquired := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	account := NewAccount()
+	// Received when worth 300, less than the donor's basis of 600
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: GIFT_IN, Asset: "BTC", Quantity: decimal.NewFromInt(3), Spot: decimal.NewFromInt(100), Currency: "USD", Counterparty: "Alice", DonorBasis: decimal.NewFromInt(600), DonorAcquired: acquired}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "600", account.Holdings["BTC"].TotalCost().String())
+
+	sales := make(chan *Sale, 3)
+	for _, spot := range []int64{250, 50, 150} {
+		err = account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 1, 0), Action: SELL, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(spot), Currency: "USD"}, sales, nil)
+		assert.Nil(t, err)
+	}
+	close(sales)
+
+	// A gain uses the donor's basis and holding period
+	sale := <-sales
+	assert.Equal(t, "200", sale.FifoCost.String())
+	assert.True(t, acquired.Equal(sale.PurchaseDate))
+	assert.Equal(t, "50", sale.Gain().String())
+
+	// A loss uses the value when received, held from the gift
+	sale = <-sales
+	assert.Equal(t, "100", sale.FifoCost.String())
+	assert.True(t, t0.Equal(sale.PurchaseDate))
+	assert.Equal(t, "-50", sale.Gain().String())
+
+	// In between there is neither a gain nor a loss
+	sale = <-sales
+	assert.Equal(t, "150", sale.FifoCost.String())
+	assert.True(t, sale.Gain().IsZero())
+
+	// A gift without the donor's basis is an error
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0, Action: GIFT_IN, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(100), Currency: "USD"}, nil, nil)
+	assert.Error(t, err)
+
+	// Gifts given are not sales
+	assert.Nil(t, account.ProcessTransaction(&Transaction{Timestamp: t0, Action: BUY, Asset: "ETH", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(10), Currency: "USD"}, nil, nil))
+	err = account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 2, 0), Action: GIFT_OUT, Asset: "ETH", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(20), Currency: "USD", Counterparty: "Bob"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", account.Holdings["ETH"].Quantity().String())
+	if assert.Equal(t, 1, len(account.Gifts)) {
+		gift := account.Gifts[0]
+		assert.Equal(t, "Bob", gift.Recipient)
+		assert.Equal(t, "20", gift.Value().String())
+		assert.Equal(t, "10", gift.Basis().String())
+	}
+}
+
+func TestAccountGiftsPool(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, model := range []BasisModel{SECTION_104, ADJUSTED_COST_BASE} {
+		gift := trade(t0, GIFT_IN, 2, 100)
+		gift.DonorBasis = decimal.NewFromInt(10)
+		account, sales := flush(t, model, []Transaction{
+			gift,
+			trade(t0.AddDate(0, 1, 0), GIFT_OUT, 1, 120),
+		})
+
+		// A pool acquires a gift at its market value, and a gift from it is
+		// a disposal at its market value
+		if assert.Equal(t, 1, len(sales)) {
+			assert.Equal(t, "100", sales[0].FifoCost.String())
+			assert.Equal(t, "120", sales[0].Proceeds.String())
+		}
+		assert.Equal(t, "100", account.Holdings["BTC"].TotalCost().String())
+		if assert.Equal(t, 1, len(account.Gifts)) {
+			assert.Equal(t, 0, len(account.Gifts[0].Lots))
+		}
+	}
+
+	// The donor's basis is not needed
+	_, sales := flush(t, ADJUSTED_COST_BASE, []Transaction{
+		trade(t0, GIFT_IN, 1, 1000),
+		trade(t0.AddDate(0, 1, 0), SELL, 1, 1000),
+	})
+	if assert.Equal(t, 1, len(sales)) {
+		assert.Equal(t, "1000", sales[0].FifoCost.String())
+		assert.True(t, sales[0].Gain().IsZero())
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, action := range []Action{BUY, SELL, CONVERT, TRANSFER_OUT, TRANSFER_IN, INCOME, GIFT_IN, GIFT_OUT} {
+		parsed, err := ParseAction(action.String())
+		assert.Nil(t, err)
+		assert.Equal(t, action, parsed)
+	}
+
+	action, err := ParseAction("transfer_in")
+	assert.Nil(t, err)
+	assert.Equal(t, TRANSFER_IN, action)
+
+	_, err = ParseAction("deposit")
+	assert.Error(t, err)
+}
@@ -0,0 +1,387 @@
+package accounting
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// poolEvent is an acquisition or disposal buffered by a pooled holding until
+// the matching rules can be applied
+type poolEvent struct {
+	date     time.Time
+	buy      bool
+	quantity decimal.Decimal
+	// amount is the cost of an acquisition or the proceeds of a disposal
+	amount decimal.Decimal
+}
+
+// pool is the shared bookkeeping of the pooled holdings.  Events are buffered
+// because matching rules look up to 30 days ahead of a disposal, so Sales are
+// only emitted when the pool is flushed.
+type pool struct {
+	Asset    string
+	Currency string
+
+	quantity decimal.Decimal
+	cost     decimal.Decimal
+	events   []poolEvent
+}
+
+func (p *pool) tail() *poolEvent {
+	if len(p.events) == 0 {
+		return nil
+	}
+	return &p.events[len(p.events)-1]
+}
+
+func (p *pool) add(e poolEvent) error {
+	if e.quantity.LessThanOrEqual(decimal.Zero) {
+		return &NegativeQuantityErr{}
+	}
+
+	if tail := p.tail(); tail != nil && e.date.Before(tail.date) {
+		return fmt.Errorf("Transactions must be in chronological order.  Transaction on %s is prior to most recent transaction dated %s", e.date, tail.date)
+	}
+
+	if !e.buy && e.quantity.GreaterThan(p.Quantity()) {
+		return fmt.Errorf("Not enough %s in pool. Sold %s but only %s held", p.Asset, e.quantity, p.Quantity())
+	}
+
+	p.events = append(p.events, e)
+	return nil
+}
+
+// Buy adds a lot to the pool
+func (p *pool) Buy(l *Lot) error {
+	if l.Spot.LessThanOrEqual(decimal.Zero) {
+		return &NegativeSpotErr{}
+	}
+
+	if l.Fees.LessThan(decimal.Zero) {
+		return &NegativeFeeErr{}
+	}
+
+	if p.Currency == "" {
+		p.Currency = l.Currency
+	}
+
+	return p.add(poolEvent{
+		date:     l.PurchaseDate,
+		buy:      true,
+		quantity: l.Quantity,
+		amount:   l.TotalCost(),
+	})
+}
+
+// Sell records a disposal from the pool, net of fees.  The resulting Sales
+// are sent when the pool is flushed.
+func (p *pool) Sell(quantity decimal.Decimal, spot decimal.Decimal, fee decimal.Decimal, date time.Time, sales chan<- *Sale) error {
+	if spot.LessThanOrEqual(decimal.Zero) {
+		return &NegativeSpotErr{}
+	}
+
+	if fee.LessThan(decimal.Zero) {
+		return &NegativeFeeErr{}
+	}
+
+	return p.add(poolEvent{
+		date:     date,
+		quantity: quantity,
+		amount:   quantity.Mul(spot).Sub(fee),
+	})
+}
+
+// open adds shares held before the first buffered event to the pool.  They
+// are not an acquisition, so no matching rule can match a disposal against
+// them.
+func (p *pool) open(quantity, cost decimal.Decimal, currency string) {
+	if p.Currency == "" {
+		p.Currency = currency
+	}
+	p.quantity = p.quantity.Add(quantity)
+	p.cost = p.cost.Add(cost)
+}
+
+// Quantity returns the total number of shares in the pool
+func (p *pool) Quantity() decimal.Decimal {
+	quantity := p.quantity
+	for _, e := range p.events {
+		if e.buy {
+			quantity = quantity.Add(e.quantity)
+		} else {
+			quantity = quantity.Sub(e.quantity)
+		}
+	}
+	return quantity
+}
+
+// flush sends the sales to the sales channel in chronological order and
+// collapses the buffered events into the pool
+func (p *pool) flush(result []*Sale, quantity, cost decimal.Decimal, sales chan<- *Sale) {
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].SaleDate.Before(result[j].SaleDate)
+	})
+	for _, s := range result {
+		sales <- s
+	}
+
+	p.quantity = quantity
+	p.cost = cost
+	p.events = p.events[:0]
+}
+
+// day truncates t to midnight UTC
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// poolDay totals the acquisitions and disposals of a pooled asset on a
+// single day, which UK rules treat as one acquisition and one disposal
+type poolDay struct {
+	date      time.Time
+	saleDate  time.Time
+	bought    decimal.Decimal
+	cost      decimal.Decimal
+	sold      decimal.Decimal
+	proceeds  decimal.Decimal
+	unbought  decimal.Decimal
+	unmatched decimal.Decimal
+}
+
+// Section104Pool is a Holding that applies the UK share matching rules:
+// disposals are matched first against acquisitions on the same day, then
+// against acquisitions in the following 30 days ("bed and breakfast"), and
+// finally against the Section 104 pool at its average cost.
+type Section104Pool struct {
+	pool
+}
+
+// NewSection104Pool initializes an empty Section104Pool for an asset
+func NewSection104Pool(asset string) *Section104Pool {
+	return &Section104Pool{pool{Asset: asset}}
+}
+
+func (p *Section104Pool) days() []*poolDay {
+	days := make([]*poolDay, 0)
+	for _, e := range p.events {
+		date := day(e.date)
+		if len(days) == 0 || !days[len(days)-1].date.Equal(date) {
+			days = append(days, &poolDay{date: date})
+		}
+		d := days[len(days)-1]
+		if e.buy {
+			d.bought = d.bought.Add(e.quantity)
+			d.cost = d.cost.Add(e.amount)
+		} else {
+			if d.sold.IsZero() {
+				d.saleDate = e.date
+			}
+			d.sold = d.sold.Add(e.quantity)
+			d.proceeds = d.proceeds.Add(e.amount)
+		}
+	}
+	for _, d := range days {
+		d.unbought = d.bought
+		d.unmatched = d.sold
+	}
+	return days
+}
+
+func (p *Section104Pool) match() ([]*Sale, decimal.Decimal, decimal.Decimal, error) {
+	days := p.days()
+	result := make([]*Sale, 0)
+
+	matchDays := func(disposal, acquisition *poolDay) {
+		quantity := decimal.Min(disposal.unmatched, acquisition.unbought)
+		if quantity.LessThanOrEqual(decimal.Zero) {
+			return
+		}
+		result = append(result, &Sale{
+			Asset:        p.Asset,
+			Currency:     p.Currency,
+			SaleDate:     disposal.saleDate,
+			PurchaseDate: acquisition.date,
+			Quantity:     quantity,
+			FifoCost:     share(acquisition.cost, quantity, acquisition.bought),
+			Proceeds:     share(disposal.proceeds, quantity, disposal.sold),
+			Pooled:       true,
+		})
+		disposal.unmatched = disposal.unmatched.Sub(quantity)
+		acquisition.unbought = acquisition.unbought.Sub(quantity)
+	}
+
+	// Same day rule
+	for _, d := range days {
+		matchDays(d, d)
+	}
+
+	// Bed and breakfast rule
+	for i, d := range days {
+		for _, later := range days[i+1:] {
+			if later.date.After(d.date.AddDate(0, 0, 30)) {
+				break
+			}
+			matchDays(d, later)
+		}
+	}
+
+	// Section 104 pool
+	quantity, cost := p.quantity, p.cost
+	for _, d := range days {
+		quantity = quantity.Add(d.unbought)
+		cost = cost.Add(share(d.cost, d.unbought, d.bought))
+
+		if d.unmatched.IsZero() {
+			continue
+		}
+		if d.unmatched.GreaterThan(quantity) {
+			return result, quantity, cost, fmt.Errorf("Not enough %s in Section 104 pool on %s. %s shares remaining", p.Asset, d.date.Format("2006-01-02"), d.unmatched.Sub(quantity))
+		}
+		poolCost := share(cost, d.unmatched, quantity)
+		result = append(result, &Sale{
+			Asset:    p.Asset,
+			Currency: p.Currency,
+			SaleDate: d.saleDate,
+			Quantity: d.unmatched,
+			FifoCost: poolCost,
+			Proceeds: share(d.proceeds, d.unmatched, d.sold),
+			Pooled:   true,
+		})
+		quantity = quantity.Sub(d.unmatched)
+		cost = cost.Sub(poolCost)
+	}
+
+	return result, quantity, cost, nil
+}
+
+// TotalCost returns the cost of the shares remaining in the Section 104 pool
+func (p *Section104Pool) TotalCost() decimal.Decimal {
+	_, _, cost, _ := p.match()
+	return cost
+}
+
+// Flush applies the matching rules to all buffered transactions and sends
+// the resulting Sales to the sales channel.  Acquisitions after a flush are
+// no longer matched against earlier disposals, so it should only be called
+// once all transactions have been processed.
+func (p *Section104Pool) Flush(sales chan<- *Sale) error {
+	result, quantity, cost, err := p.match()
+	if err != nil {
+		return err
+	}
+	p.flush(result, quantity, cost, sales)
+	return nil
+}
+
+// AdjustedCostBasePool is a Holding that tracks the Canadian adjusted cost
+// base (ACB) of an asset.  Losses are denied under the superficial loss rule
+// when the asset is acquired in the 30 days before or after the disposal and
+// still held 30 days after it.  The denied loss is added to the ACB of the
+// remaining or replacement shares.
+type AdjustedCostBasePool struct {
+	pool
+
+	// denied is a superficial loss waiting for a replacement acquisition
+	denied decimal.Decimal
+}
+
+// NewAdjustedCostBasePool initializes an empty AdjustedCostBasePool for an asset
+func NewAdjustedCostBasePool(asset string) *AdjustedCostBasePool {
+	return &AdjustedCostBasePool{pool: pool{Asset: asset}}
+}
+
+func (p *AdjustedCostBasePool) match() ([]*Sale, decimal.Decimal, decimal.Decimal, decimal.Decimal) {
+	result := make([]*Sale, 0)
+
+	// Shares held after each event, used to test the superficial loss rule
+	held := make([]decimal.Decimal, len(p.events))
+	quantity := p.quantity
+	for i, e := range p.events {
+		if e.buy {
+			quantity = quantity.Add(e.quantity)
+		} else {
+			quantity = quantity.Sub(e.quantity)
+		}
+		held[i] = quantity
+	}
+
+	quantity, cost, denied := p.quantity, p.cost, p.denied
+	for i, e := range p.events {
+		if e.buy {
+			quantity = quantity.Add(e.quantity)
+			cost = cost.Add(e.amount).Add(denied)
+			denied = decimal.Zero
+			continue
+		}
+
+		saleCost := share(cost, e.quantity, quantity)
+		sale := &Sale{
+			Asset:    p.Asset,
+			Currency: p.Currency,
+			SaleDate: e.date,
+			Quantity: e.quantity,
+			FifoCost: saleCost,
+			Proceeds: e.amount,
+			Pooled:   true,
+		}
+		quantity = quantity.Sub(e.quantity)
+		cost = cost.Sub(saleCost)
+
+		loss := saleCost.Sub(e.amount)
+		if loss.GreaterThan(decimal.Zero) {
+			start := day(e.date).AddDate(0, 0, -30)
+			end := day(e.date).AddDate(0, 0, 31)
+
+			acquired := decimal.Zero
+			heldAtEnd := held[i]
+			for j, other := range p.events {
+				if other.date.Before(start) {
+					continue
+				}
+				if !other.date.Before(end) {
+					break
+				}
+				if other.buy {
+					acquired = acquired.Add(other.quantity)
+				}
+				if j >= i {
+					heldAtEnd = held[j]
+				}
+			}
+
+			superficial := decimal.Min(e.quantity, acquired, heldAtEnd)
+			if superficial.GreaterThan(decimal.Zero) {
+				sale.DisallowedLoss = share(loss, superficial, e.quantity)
+				if quantity.GreaterThan(decimal.Zero) {
+					cost = cost.Add(sale.DisallowedLoss)
+				} else {
+					denied = denied.Add(sale.DisallowedLoss)
+				}
+			}
+		}
+
+		result = append(result, sale)
+	}
+
+	return result, quantity, cost, denied
+}
+
+// TotalCost returns the adjusted cost base of the shares held
+func (p *AdjustedCostBasePool) TotalCost() decimal.Decimal {
+	_, _, cost, _ := p.match()
+	return cost
+}
+
+// Flush applies the superficial loss rule to all buffered transactions and
+// sends the resulting Sales to the sales channel.  It should only be called
+// once all transactions have been processed.
+func (p *AdjustedCostBasePool) Flush(sales chan<- *Sale) error {
+	result, quantity, cost, denied := p.match()
+	p.flush(result, quantity, cost, sales)
+	p.denied = denied
+	return nil
+}
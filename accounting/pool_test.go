@@ -0,0 +1,145 @@
+package accounting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// flush replays transactions through an Account using model, returning the
+// sales sent once the account is flushed
+func flush(t *testing.T, model BasisModel, transactions []Transaction) (*Account, []*Sale) {
+	account := NewAccount()
+	account.Model = model
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		for i := range transactions {
+			err := account.ProcessTransaction(&transactions[i], sales, nil)
+			assert.Nil(t, err)
+		}
+		err := account.Flush(sales)
+		assert.Nil(t, err)
+	}()
+
+	result := make([]*Sale, 0)
+	for s := range sales {
+		result = append(result, s)
+	}
+	return account, result
+}
+
+func trade(date time.Time, action Action, quantity, spot int64) Transaction {
+	return Transaction{
+		Timestamp: date,
+		Action:    action,
+		Asset:     "BTC",
+		Quantity:  decimal.NewFromInt(quantity),
+		Spot:      decimal.NewFromInt(spot),
+	}
+}
+
+func TestSection104Pool(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	account, sales := flush(t, SECTION_104, []Transaction{
+		trade(t0, BUY, 1000, 4),
+		trade(t0.AddDate(0, 0, 100), BUY, 500, 4),
+		trade(t0.AddDate(0, 0, 200), SELL, 700, 6),
+		// Bed and breakfast, matched against the previous sale
+		trade(t0.AddDate(0, 0, 210), BUY, 200, 5),
+		// Same day
+		trade(t0.AddDate(0, 0, 300), BUY, 50, 6),
+		trade(t0.AddDate(0, 0, 300).Add(time.Hour), SELL, 50, 8),
+	})
+
+	if assert.Equal(t, 3, len(sales)) {
+		assert.Equal(t, "200", sales[0].Quantity.String())
+		assert.Equal(t, "1000", sales[0].FifoCost.String())
+		assert.Equal(t, "1200", sales[0].Proceeds.String())
+		assert.Equal(t, day(t0.AddDate(0, 0, 210)), sales[0].PurchaseDate)
+		assert.Equal(t, POOLED, sales[0].Term())
+
+		assert.Equal(t, "500", sales[1].Quantity.String())
+		assert.Equal(t, "2000", sales[1].FifoCost.String())
+		assert.Equal(t, "3000", sales[1].Proceeds.String())
+		assert.True(t, sales[1].PurchaseDate.IsZero())
+
+		assert.Equal(t, "50", sales[2].Quantity.String())
+		assert.Equal(t, "300", sales[2].FifoCost.String())
+		assert.Equal(t, "400", sales[2].Proceeds.String())
+	}
+
+	holding := account.Holdings["BTC"]
+	assert.Equal(t, "1000", holding.Quantity().String())
+	assert.Equal(t, "4000", holding.TotalCost().String())
+}
+
+func TestSection104PoolOversold(t *testing.T) {
+	p := NewSection104Pool("BTC")
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, p.Buy(&Lot{PurchaseDate: t0, Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(1)}))
+	assert.Error(t, p.Sell(decimal.NewFromInt(2), decimal.NewFromInt(1), decimal.Zero, t0.AddDate(0, 0, 1), nil))
+}
+
+func TestAdjustedCostBasePool(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	account, sales := flush(t, ADJUSTED_COST_BASE, []Transaction{
+		trade(t0, BUY, 100, 10),
+		// Superficial loss, shares are repurchased within 30 days
+		trade(t0.AddDate(0, 0, 10), SELL, 50, 6),
+		trade(t0.AddDate(0, 0, 20), BUY, 20, 5),
+		trade(t0.AddDate(0, 0, 100), SELL, 70, 20),
+		// Loss with no repurchase is allowed
+		trade(t0.AddDate(0, 0, 200), BUY, 10, 10),
+		trade(t0.AddDate(0, 0, 210), SELL, 10, 5),
+	})
+
+	if assert.Equal(t, 3, len(sales)) {
+		assert.Equal(t, "500", sales[0].FifoCost.String())
+		assert.Equal(t, "300", sales[0].Proceeds.String())
+		assert.Equal(t, "200", sales[0].DisallowedLoss.String())
+		assert.Equal(t, "0", sales[0].Gain().String())
+
+		assert.Equal(t, "800", sales[1].FifoCost.String())
+		assert.Equal(t, "1400", sales[1].Proceeds.String())
+		assert.True(t, sales[1].DisallowedLoss.IsZero())
+
+		assert.Equal(t, "100", sales[2].FifoCost.String())
+		assert.Equal(t, "-50", sales[2].Gain().String())
+	}
+
+	assert.True(t, account.Holdings["BTC"].Quantity().IsZero())
+}
+
+func TestPoolTransfers(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, model := range []BasisModel{SECTION_104, ADJUSTED_COST_BASE} {
+		account, sales := flush(t, model, []Transaction{
+			// Received without a transfer out, so acquired at the spot price
+			trade(t0, TRANSFER_IN, 1, 100),
+			trade(t0.AddDate(0, 0, 1), TRANSFER_OUT, 1, 0),
+			// Received back, leaving the pool unchanged
+			trade(t0.AddDate(0, 0, 2), TRANSFER_IN, 1, 200),
+			trade(t0.AddDate(0, 0, 3), TRANSFER_IN, 1, 300),
+			trade(t0.AddDate(0, 0, 4), SELL, 2, 500),
+		})
+
+		if assert.Equal(t, 1, len(sales)) {
+			assert.Equal(t, "400", sales[0].FifoCost.String())
+		}
+		assert.True(t, account.Holdings["BTC"].Quantity().IsZero())
+	}
+
+	// Shares received without a transfer out need a spot price
+	account := NewAccount()
+	account.Model = SECTION_104
+	err := account.ProcessTransaction(&Transaction{Timestamp: t0, Action: TRANSFER_IN, Asset: "BTC", Quantity: decimal.NewFromInt(1)}, nil, nil)
+	assert.Error(t, err)
+}
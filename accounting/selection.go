@@ -0,0 +1,99 @@
+package accounting
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LotSelectionMethod decides which Lot in a LotHistory a sale is matched
+// against next
+type LotSelectionMethod interface {
+	// Next returns the index of the lot to sell from.  lots is never empty.
+	Next(lots []*Lot, saleDate time.Time) int
+}
+
+// FIFO sells the earliest purchased lot first
+type FIFO struct{}
+
+// Next returns the first lot
+func (FIFO) Next(lots []*Lot, saleDate time.Time) int {
+	return 0
+}
+
+// LIFO sells the most recently purchased lot first
+type LIFO struct{}
+
+// Next returns the last lot
+func (LIFO) Next(lots []*Lot, saleDate time.Time) int {
+	return len(lots) - 1
+}
+
+// HIFO sells the lot with the highest cost per share first.  Ties are
+// broken by purchase date.
+type HIFO struct{}
+
+// Next returns the lot with the highest cost per share
+func (HIFO) Next(lots []*Lot, saleDate time.Time) int {
+	idx := 0
+	for i, l := range lots {
+		if l.UnitCost().GreaterThan(lots[idx].UnitCost()) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// Designation identifies the lot, by purchase date, that a sale on SaleDate
+// should be matched against.  A Designation without an Asset applies to
+// every asset.
+type Designation struct {
+	Asset        string
+	SaleDate     time.Time
+	PurchaseDate time.Time
+}
+
+// SpecificIdentification sells the lots designated for each sale, in the
+// order they are listed.  Sales without a designation, or whose designated
+// lots are exhausted, fall back to FIFO.
+type SpecificIdentification []Designation
+
+// Next returns the first designated lot that is still available
+func (s SpecificIdentification) Next(lots []*Lot, saleDate time.Time) int {
+	for _, d := range s {
+		if !d.SaleDate.Equal(saleDate) {
+			continue
+		}
+		for i, l := range lots {
+			if l.PurchaseDate.Equal(d.PurchaseDate) {
+				return i
+			}
+		}
+	}
+	return FIFO{}.Next(lots, saleDate)
+}
+
+// forAsset returns the designations that apply to sales of asset
+func (s SpecificIdentification) forAsset(asset string) SpecificIdentification {
+	designations := make(SpecificIdentification, 0, len(s))
+	for _, d := range s {
+		if d.Asset == "" || d.Asset == asset {
+			designations = append(designations, d)
+		}
+	}
+	return designations
+}
+
+// ParseLotSelectionMethod returns the LotSelectionMethod for a name
+// (fifo, lifo or hifo)
+func ParseLotSelectionMethod(name string) (LotSelectionMethod, error) {
+	switch strings.ToLower(name) {
+	case "fifo":
+		return FIFO{}, nil
+	case "lifo":
+		return LIFO{}, nil
+	case "hifo":
+		return HIFO{}, nil
+	}
+	return nil, fmt.Errorf("Unknown lot selection method '%s'", name)
+}
@@ -0,0 +1,197 @@
+package accounting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+// basicTransactions returns the same BUY/SELL sequence used in
+// TestBasicLotHistoryUsage
+func basicTransactions(t0 time.Time) []Transaction {
+	trades := []struct {
+		action   Action
+		quantity int64
+		spot     int64
+	}{
+		{BUY, 100, 1},
+		{BUY, 100, 2},
+		{SELL, 200, 3},
+		{BUY, 100, 10},
+		{BUY, 100, 5},
+		{SELL, 5, 2},
+		{SELL, 94, 100},
+		{SELL, 2, 5},
+	}
+
+	transactions := make([]Transaction, 0, len(trades))
+	for i, trade := range trades {
+		transactions = append(transactions, Transaction{
+			Timestamp: t0.AddDate(0, 0, i),
+			Action:    trade.action,
+			Asset:     "BTC",
+			Quantity:  decimal.NewFromInt(trade.quantity),
+			Spot:      decimal.NewFromInt(trade.spot),
+		})
+	}
+	return transactions
+}
+
+// replay runs transactions through a LotHistory using method, returning the
+// resulting sales
+func replay(method LotSelectionMethod, transactions []Transaction) (*LotHistory, []*Sale) {
+	h := &LotHistory{
+		Asset:  "BTC",
+		Lots:   make([]*Lot, 0),
+		Method: method,
+	}
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		for _, t := range transactions {
+			switch t.Action {
+			case BUY:
+				h.Buy(t.ToLot())
+			case SELL:
+				h.Sell(t.Quantity, t.Spot, t.Fee, t.Timestamp, sales)
+			}
+		}
+	}()
+
+	result := make([]*Sale, 0)
+	for s := range sales {
+		result = append(result, s)
+	}
+	return h, result
+}
+
+func TestLotSelectionMethods(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Each expected sale is {quantity, cost, proceeds}
+	tests := []struct {
+		name      string
+		method    LotSelectionMethod
+		expected  [][3]int64
+		remaining int64
+		cost      int64
+	}{
+		{
+			name:   "FIFO",
+			method: nil,
+			expected: [][3]int64{
+				{100, 100 * 1, 100 * 3},
+				{100, 100 * 2, 100 * 3},
+				{5, 5 * 10, 5 * 2},
+				{94, 94 * 10, 94 * 100},
+				{1, 1 * 10, 1 * 5},
+				{1, 1 * 5, 1 * 5},
+			},
+			remaining: 99,
+			cost:      99 * 5,
+		},
+		{
+			name:   "LIFO",
+			method: LIFO{},
+			expected: [][3]int64{
+				{100, 100 * 2, 100 * 3},
+				{100, 100 * 1, 100 * 3},
+				{5, 5 * 5, 5 * 2},
+				{94, 94 * 5, 94 * 100},
+				{1, 1 * 5, 1 * 5},
+				{1, 1 * 10, 1 * 5},
+			},
+			remaining: 99,
+			cost:      99 * 10,
+		},
+		{
+			name:   "HIFO",
+			method: HIFO{},
+			expected: [][3]int64{
+				{100, 100 * 2, 100 * 3},
+				{100, 100 * 1, 100 * 3},
+				{5, 5 * 10, 5 * 2},
+				{94, 94 * 10, 94 * 100},
+				{1, 1 * 10, 1 * 5},
+				{1, 1 * 5, 1 * 5},
+			},
+			remaining: 99,
+			cost:      99 * 5,
+		},
+		{
+			name: "SpecificIdentification",
+			method: SpecificIdentification{
+				{SaleDate: t0.AddDate(0, 0, 2), PurchaseDate: t0.AddDate(0, 0, 1)},
+				{SaleDate: t0.AddDate(0, 0, 2), PurchaseDate: t0},
+				{SaleDate: t0.AddDate(0, 0, 5), PurchaseDate: t0.AddDate(0, 0, 4)},
+			},
+			expected: [][3]int64{
+				{100, 100 * 2, 100 * 3},
+				{100, 100 * 1, 100 * 3},
+				{5, 5 * 5, 5 * 2},
+				{94, 94 * 10, 94 * 100},
+				{2, 2 * 10, 2 * 5},
+			},
+			remaining: 99,
+			cost:      4*10 + 95*5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, sales := replay(tt.method, basicTransactions(t0))
+
+			assert.Equal(t, len(tt.expected), len(sales))
+			for i, s := range sales {
+				if i >= len(tt.expected) {
+					break
+				}
+				assert.Equal(t, decimal.NewFromInt(tt.expected[i][0]).String(), s.Quantity.String(), "sale %d quantity", i)
+				assert.Equal(t, decimal.NewFromInt(tt.expected[i][1]).String(), s.FifoCost.String(), "sale %d cost", i)
+				assert.Equal(t, decimal.NewFromInt(tt.expected[i][2]).String(), s.Proceeds.String(), "sale %d proceeds", i)
+			}
+
+			assert.Equal(t, decimal.NewFromInt(tt.remaining).String(), h.Quantity().String())
+			assert.Equal(t, decimal.NewFromInt(tt.cost).String(), h.TotalCost().String())
+		})
+	}
+}
+
+func TestParseLotSelectionMethod(t *testing.T) {
+	m, err := ParseLotSelectionMethod("HIFO")
+	assert.Nil(t, err)
+	assert.Equal(t, HIFO{}, m)
+
+	_, err = ParseLotSelectionMethod("average")
+	assert.Error(t, err)
+}
+
+func TestSpecificIdentificationAsset(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	account := NewAccount()
+	account.Method = SpecificIdentification{
+		{Asset: "ETH", SaleDate: t0.AddDate(0, 0, 2), PurchaseDate: t0.AddDate(0, 0, 1)},
+	}
+
+	sales := make(chan *Sale, 2)
+	for _, asset := range []string{"BTC", "ETH"} {
+		for _, tr := range []Transaction{
+			{Timestamp: t0, Action: BUY, Asset: asset, Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(10)},
+			{Timestamp: t0.AddDate(0, 0, 1), Action: BUY, Asset: asset, Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(20)},
+			{Timestamp: t0.AddDate(0, 0, 2), Action: SELL, Asset: asset, Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(30)},
+		} {
+			tr := tr
+			assert.Nil(t, account.ProcessTransaction(&tr, sales, nil))
+		}
+	}
+	close(sales)
+
+	// The designation only applies to ETH, so BTC falls back to FIFO
+	btc, eth := <-sales, <-sales
+	assert.Equal(t, "10", btc.FifoCost.String())
+	assert.Equal(t, "20", eth.FifoCost.String())
+}
@@ -0,0 +1,300 @@
+package accounting
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// AssetTotal is the quantity and cost basis of an asset held
+type AssetTotal struct {
+	Quantity decimal.Decimal `json:"quantity"`
+	Cost     decimal.Decimal `json:"cost"`
+}
+
+// Snapshot is the state of an Account's holdings before AsOf, such as at
+// the end of a tax year, so that a later run can start from it instead of
+// replaying every earlier transaction.  Lots are the lots held per asset,
+// keeping their original purchase dates and basis, and InTransit the lots
+// transferred out that have not been received back yet.  Totals is the
+// quantity and cost of every asset, counting the lots in transit, and is
+// used to check that the lots are loaded as they were saved.  Sent is the
+// quantity of each pooled asset transferred out and not received back yet,
+// which is still part of its pool.
+type Snapshot struct {
+	AsOf      time.Time                  `json:"as_of"`
+	Currency  string                     `json:"currency,omitempty"`
+	Lots      map[string][]*Lot          `json:"lots"`
+	InTransit map[string][]*Lot          `json:"in_transit"`
+	Totals    map[string]*AssetTotal     `json:"totals"`
+	Sent      map[string]decimal.Decimal `json:"sent,omitempty"`
+}
+
+// copyLots returns a copy of lots that can be changed independently
+func copyLots(lots []*Lot) []*Lot {
+	copies := make([]*Lot, 0, len(lots))
+	for _, l := range lots {
+		lot := *l
+		copies = append(copies, &lot)
+	}
+	return copies
+}
+
+// costLot returns a single lot of quantity shares bought on date with a
+// total cost of exactly cost, the remainder of the spot price going to its
+// fees
+func costLot(date time.Time, quantity, cost decimal.Decimal, currency string) *Lot {
+	spot, remainder := cost.QuoRem(quantity, 16)
+	return &Lot{
+		PurchaseDate: date,
+		Quantity:     quantity,
+		Spot:         spot,
+		Fees:         remainder,
+		Currency:     currency,
+	}
+}
+
+// totals returns the quantity and cost of every asset in the lots
+func totals(lots ...map[string][]*Lot) map[string]*AssetTotal {
+	result := make(map[string]*AssetTotal)
+	for _, m := range lots {
+		for asset, assetLots := range m {
+			for _, l := range assetLots {
+				total, ok := result[asset]
+				if !ok {
+					total = &AssetTotal{}
+					result[asset] = total
+				}
+				total.Quantity = total.Quantity.Add(l.Quantity)
+				total.Cost = total.Cost.Add(l.TotalCost())
+			}
+		}
+	}
+	return result
+}
+
+// checkTotals returns an error if found differs from the saved totals
+func checkTotals(saved, found map[string]*AssetTotal) error {
+	assets := make([]string, 0, len(saved)+len(found))
+	for asset := range saved {
+		assets = append(assets, asset)
+	}
+	for asset := range found {
+		if _, ok := saved[asset]; !ok {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Strings(assets)
+
+	for _, asset := range assets {
+		s, f := saved[asset], found[asset]
+		if s == nil {
+			s = &AssetTotal{}
+		}
+		if f == nil {
+			f = &AssetTotal{}
+		}
+		if !s.Quantity.Equal(f.Quantity) || !s.Cost.Equal(f.Cost) {
+			return fmt.Errorf("Opening lots of %s total %s at a cost of %s, but %s at a cost of %s were saved", asset, f.Quantity, f.Cost, s.Quantity, s.Cost)
+		}
+	}
+	return nil
+}
+
+// Validate checks that every lot could have been bought by AsOf and
+// that the lots add up to the saved Totals
+func (s *Snapshot) Validate() error {
+	if s.AsOf.IsZero() {
+		return fmt.Errorf("Opening lots have no as of date")
+	}
+
+	for _, lots := range []map[string][]*Lot{s.Lots, s.InTransit} {
+		for asset, assetLots := range lots {
+			for _, l := range assetLots {
+				if l.Quantity.LessThanOrEqual(decimal.Zero) {
+					return &NegativeQuantityErr{}
+				}
+				if l.Spot.LessThanOrEqual(decimal.Zero) {
+					return &NegativeSpotErr{}
+				}
+				if l.Fees.LessThan(decimal.Zero) {
+					return &NegativeFeeErr{}
+				}
+				if l.PurchaseDate.After(s.AsOf) {
+					return fmt.Errorf("Opening lot of %s %s purchased on %s is after %s", l.Quantity, asset, l.PurchaseDate, s.AsOf)
+				}
+				if l.Currency != "" && s.Currency != "" && l.Currency != s.Currency {
+					return &CurrencyMismatchErr{Expected: s.Currency, Found: l.Currency}
+				}
+			}
+		}
+	}
+
+	for _, quantity := range s.Sent {
+		if quantity.LessThan(decimal.Zero) {
+			return &NegativeQuantityErr{}
+		}
+	}
+
+	return checkTotals(s.Totals, totals(s.Lots, s.InTransit))
+}
+
+// Write writes the Snapshot to w in JSON format
+func (s *Snapshot) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// ReadSnapshot reads a Snapshot in JSON format from r, checking that it is
+// valid
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := &Snapshot{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(s); err != nil {
+		return nil, fmt.Errorf("Invalid opening lots: %s", err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Snapshot returns the lots held by the account, and those in transit, to
+// be saved as of asOf.  Pooled holdings have no lots, so each pool is saved
+// as a single lot dated asOf with the quantity and cost of the pool.  A
+// superficial loss of an ACB pool that is waiting for a replacement
+// acquisition is not saved.
+func (a *Account) Snapshot(asOf time.Time) *Snapshot {
+	s := &Snapshot{
+		AsOf:      asOf,
+		Currency:  a.Currency,
+		Lots:      make(map[string][]*Lot),
+		InTransit: make(map[string][]*Lot),
+	}
+
+	for asset, holding := range a.Holdings {
+		if holding.Quantity().LessThanOrEqual(decimal.Zero) {
+			continue
+		}
+		if history, ok := holding.(*LotHistory); ok {
+			s.Lots[asset] = copyLots(history.Lots)
+			continue
+		}
+		s.Lots[asset] = []*Lot{costLot(asOf, holding.Quantity(), holding.TotalCost(), a.Currency)}
+	}
+	for asset, transit := range a.InTransit {
+		if len(transit.Lots) > 0 {
+			s.InTransit[asset] = copyLots(transit.Lots)
+		}
+	}
+	for asset, quantity := range a.sent {
+		if quantity.GreaterThan(decimal.Zero) {
+			if s.Sent == nil {
+				s.Sent = make(map[string]decimal.Decimal)
+			}
+			s.Sent[asset] = quantity
+		}
+	}
+
+	s.Totals = totals(s.Lots, s.InTransit)
+	return s
+}
+
+// poolOpener is a pooled Holding that shares held before the first
+// transaction can be added to
+type poolOpener interface {
+	open(quantity, cost decimal.Decimal, currency string)
+}
+
+// Open loads the lots of a Snapshot into an account with no holdings, so
+// that the transactions from the Snapshot's AsOf date on can be processed.  The
+// model and lot selection methods of the account must be set beforehand.
+// Pooled holdings span every wallet, so lots in transit are added to their
+// pool.
+func (a *Account) Open(s *Snapshot) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	for asset, holding := range a.Holdings {
+		if !holding.Quantity().IsZero() {
+			return fmt.Errorf("Cannot load opening lots into an account holding %s", asset)
+		}
+	}
+	for asset, transit := range a.InTransit {
+		if !transit.Quantity().IsZero() {
+			return fmt.Errorf("Cannot load opening lots into an account with %s in transit", asset)
+		}
+	}
+
+	for asset, quantity := range a.sent {
+		if !quantity.IsZero() {
+			return fmt.Errorf("Cannot load opening lots into an account with %s in transit", asset)
+		}
+	}
+
+	if s.Currency != "" {
+		if a.Currency != "" && a.Currency != s.Currency {
+			return &CurrencyMismatchErr{Expected: a.Currency, Found: s.Currency}
+		}
+		a.Currency = s.Currency
+	}
+
+	assets := make([]string, 0, len(s.Totals))
+	for asset := range s.Totals {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	for _, asset := range assets {
+		lots, transit := copyLots(s.Lots[asset]), copyLots(s.InTransit[asset])
+		holding := a.holding(asset)
+
+		if holder, ok := holding.(lotHolder); ok {
+			holder.Deposit(lots)
+			if len(transit) > 0 {
+				a.inTransit(asset).Deposit(transit)
+			}
+			continue
+		}
+
+		// Opening a pool is not an acquisition on AsOf, so the shares are
+		// added to the pool itself rather than bought
+		opener, ok := holding.(poolOpener)
+		if !ok {
+			return fmt.Errorf("Cannot load opening lots of %s into a %T", asset, holding)
+		}
+		for _, l := range append(lots, transit...) {
+			opener.open(l.Quantity, l.TotalCost(), l.Currency)
+		}
+	}
+
+	if len(s.Sent) > 0 {
+		a.sent = make(map[string]decimal.Decimal)
+		for asset, quantity := range s.Sent {
+			a.sent[asset] = quantity
+		}
+	}
+
+	// Pools are saved as a single lot, and lose the purchase dates of the
+	// lots they are loaded from, so compare what is held rather than lots
+	found := make(map[string]*AssetTotal)
+	for _, asset := range assets {
+		total := &AssetTotal{
+			Quantity: a.holding(asset).Quantity(),
+			Cost:     a.holding(asset).TotalCost(),
+		}
+		if transit, ok := a.InTransit[asset]; ok {
+			total.Quantity = total.Quantity.Add(transit.Quantity())
+			total.Cost = total.Cost.Add(transit.TotalCost())
+		}
+		found[asset] = total
+	}
+	return checkTotals(s.Totals, found)
+}
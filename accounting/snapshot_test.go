@@ -0,0 +1,205 @@
+package accounting
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	asOf := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	account := NewAccount()
+	transactions := []*Transaction{
+		{Timestamp: t0, Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(100), Fee: decimal.NewFromInt(3), Currency: "USD"},
+		{Timestamp: t0.AddDate(0, 1, 0), Action: BUY, Asset: "BTC", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(200), Currency: "USD"},
+		{Timestamp: t0.AddDate(0, 2, 0), Action: TRANSFER_OUT, Asset: "BTC", Quantity: decimal.NewFromFloat(0.5)},
+		{Timestamp: t0.AddDate(0, 3, 0), Action: BUY, Asset: "ETH", Quantity: decimal.NewFromInt(10), Spot: decimal.NewFromInt(50), Currency: "USD"},
+		{Timestamp: t0.AddDate(0, 4, 0), Action: SELL, Asset: "ETH", Quantity: decimal.NewFromInt(10), Spot: decimal.NewFromInt(60), Currency: "USD"},
+	}
+	sales := make(chan *Sale, len(transactions))
+	for _, tr := range transactions {
+		assert.Nil(t, account.ProcessTransaction(tr, sales, nil))
+	}
+
+	s := account.Snapshot(asOf)
+	assert.Equal(t, "USD", s.Currency)
+	assert.Equal(t, 2, len(s.Lots["BTC"]))
+	assert.Equal(t, 1, len(s.InTransit["BTC"]))
+	// Assets sold out are not saved
+	assert.NotContains(t, s.Lots, "ETH")
+	assert.Equal(t, "3", s.Totals["BTC"].Quantity.String())
+	assert.Equal(t, "503", s.Totals["BTC"].Cost.String())
+
+	var buf bytes.Buffer
+	assert.Nil(t, s.Write(&buf))
+	loaded, err := ReadSnapshot(&buf)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.True(t, asOf.Equal(loaded.AsOf))
+
+	opened := NewAccount()
+	assert.Nil(t, opened.Open(loaded))
+	assert.Equal(t, "USD", opened.Currency)
+	assert.Equal(t, "2.5", opened.Holdings["BTC"].Quantity().String())
+	assert.Equal(t, "0.5", opened.InTransit["BTC"].Quantity().String())
+
+	// The opening lots keep their purchase dates and basis
+	sales = make(chan *Sale, 2)
+	err = opened.ProcessTransaction(&Transaction{Timestamp: asOf.AddDate(0, 1, 0), Action: SELL, Asset: "BTC", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(300), Currency: "USD"}, sales, nil)
+	assert.Nil(t, err)
+	close(sales)
+	first := <-sales
+	assert.True(t, t0.Equal(first.PurchaseDate))
+	assert.Equal(t, "51.5", first.FifoCost.String())
+	second := <-sales
+	assert.True(t, t0.AddDate(0, 1, 0).Equal(second.PurchaseDate))
+	assert.Equal(t, "300", second.FifoCost.String())
+
+	// The lots in transit can still be received back
+	err = opened.ProcessTransaction(&Transaction{Timestamp: asOf.AddDate(0, 2, 0), Action: TRANSFER_IN, Asset: "BTC", Quantity: decimal.NewFromFloat(0.5)}, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", opened.Holdings["BTC"].Quantity().String())
+	assert.Equal(t, "151.5", opened.Holdings["BTC"].TotalCost().String())
+
+	// An account that already holds assets cannot be opened
+	assert.Error(t, opened.Open(s))
+}
+
+func TestSnapshotValidate(t *testing.T) {
+	valid := `{
+  "as_of": "2021-01-01T00:00:00Z",
+  "currency": "USD",
+  "lots": {
+    "BTC": [
+      {"purchase_date": "2020-03-01T00:00:00Z", "quantity": "1.5", "spot": "100", "fees": "1", "currency": "USD"}
+    ]
+  },
+  "in_transit": {},
+  "totals": {
+    "BTC": {"quantity": "1.5", "cost": "151"}
+  }
+}`
+
+	s, err := ReadSnapshot(strings.NewReader(valid))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "151", s.Lots["BTC"][0].TotalCost().String())
+	}
+
+	invalid := []string{
+		// Totals that don't match the lots
+		strings.Replace(valid, `"cost": "151"`, `"cost": "150"`, 1),
+		strings.Replace(valid, `"quantity": "1.5", "cost"`, `"quantity": "2", "cost"`, 1),
+		// Lots of an asset missing from the totals
+		strings.Replace(valid, `"BTC": {"quantity"`, `"ETH": {"quantity"`, 1),
+		// Lots bought after the as of date
+		strings.Replace(valid, "2020-03-01", "2021-03-01", 1),
+		strings.Replace(valid, `"spot": "100"`, `"spot": "0"`, 1),
+		strings.Replace(valid, `"currency": "USD"}`, `"currency": "EUR"}`, 1),
+		strings.Replace(valid, `"as_of": "2021-01-01T00:00:00Z",`, "", 1),
+		strings.Replace(valid, `"totals"`, `"total"`, 1),
+	}
+	for _, data := range invalid {
+		_, err := ReadSnapshot(strings.NewReader(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestSnapshotPool(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	asOf := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	account, _ := flush(t, SECTION_104, []Transaction{
+		trade(t0, BUY, 3, 10),
+		trade(t0.AddDate(0, 0, 100), BUY, 3, 11),
+		trade(t0.AddDate(0, 0, 200), SELL, 2, 12),
+	})
+
+	// A pool is saved as a single lot with the cost of the pool
+	s := account.Snapshot(asOf)
+	if assert.Equal(t, 1, len(s.Lots["BTC"])) {
+		assert.Equal(t, "4", s.Lots["BTC"][0].Quantity.String())
+		assert.True(t, asOf.Equal(s.Lots["BTC"][0].PurchaseDate))
+	}
+	assert.Equal(t, account.Holdings["BTC"].TotalCost().String(), s.Totals["BTC"].Cost.String())
+	assert.Nil(t, s.Validate())
+
+	// A pool has the same quantity and cost once opened
+	opened := NewAccount()
+	opened.Model = SECTION_104
+	assert.Nil(t, opened.Open(s))
+	assert.Equal(t, "4", opened.Holdings["BTC"].Quantity().String())
+	assert.Equal(t, s.Totals["BTC"].Cost.String(), opened.Holdings["BTC"].TotalCost().String())
+
+	// Shares transferred out of a pool can be received back once opened
+	assert.Nil(t, account.ProcessTransaction(&Transaction{Timestamp: t0.AddDate(0, 0, 300), Action: TRANSFER_OUT, Asset: "BTC", Quantity: decimal.NewFromInt(1)}, nil, nil))
+	s = account.Snapshot(asOf.AddDate(1, 0, 0))
+	assert.Equal(t, "1", s.Sent["BTC"].String())
+
+	opened = NewAccount()
+	opened.Model = SECTION_104
+	assert.Nil(t, opened.Open(s))
+	assert.Nil(t, opened.ProcessTransaction(&Transaction{Timestamp: asOf.AddDate(1, 0, 1), Action: TRANSFER_IN, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(20)}, nil, nil))
+	assert.Equal(t, "4", opened.Holdings["BTC"].Quantity().String())
+}
+
+// open replays transactions through an Account using model, opened from
+// the snapshot s, returning the sales sent once the account is flushed
+func open(t *testing.T, model BasisModel, s *Snapshot, transactions []Transaction) []*Sale {
+	account := NewAccount()
+	account.Model = model
+	assert.Nil(t, account.Open(s))
+
+	sales := make(chan *Sale)
+	go func() {
+		defer close(sales)
+		for i := range transactions {
+			assert.Nil(t, account.ProcessTransaction(&transactions[i], sales, nil))
+		}
+		assert.Nil(t, account.Flush(sales))
+	}()
+
+	result := make([]*Sale, 0)
+	for s := range sales {
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestSnapshotPoolOpening(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	asOf := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Only the share bought after the snapshot replaces one of the two sold
+	// at a loss, so half the loss is superficial
+	account, _ := flush(t, ADJUSTED_COST_BASE, []Transaction{trade(t0, BUY, 9, 100)})
+	sales := open(t, ADJUSTED_COST_BASE, account.Snapshot(asOf), []Transaction{
+		trade(asOf.AddDate(0, 0, 5), BUY, 1, 100),
+		trade(asOf.AddDate(0, 0, 10), SELL, 2, 40),
+	})
+	if assert.Equal(t, 1, len(sales)) {
+		assert.Equal(t, "200", sales[0].FifoCost.String())
+		assert.Equal(t, "80", sales[0].Proceeds.String())
+		assert.Equal(t, "60", sales[0].DisallowedLoss.String())
+	}
+
+	// A sale on the snapshot date is not matched against the opening pool
+	// as a same-day acquisition
+	account, _ = flush(t, SECTION_104, []Transaction{trade(t0, BUY, 10, 100)})
+	sales = open(t, SECTION_104, account.Snapshot(asOf), []Transaction{
+		trade(asOf.Add(time.Hour), SELL, 2, 150),
+		trade(asOf.AddDate(0, 0, 5), BUY, 1, 200),
+	})
+	if assert.Equal(t, 2, len(sales)) {
+		assert.Equal(t, "200", sales[0].FifoCost.String())
+		assert.Equal(t, day(asOf.AddDate(0, 0, 5)), sales[0].PurchaseDate)
+		assert.Equal(t, "100", sales[1].FifoCost.String())
+		assert.True(t, sales[1].PurchaseDate.IsZero())
+	}
+}
@@ -0,0 +1,80 @@
+package accounting
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// washLoss is a sale at a loss whose shares have not all been replaced
+type washLoss struct {
+	sale      *Sale
+	loss      decimal.Decimal
+	remaining decimal.Decimal
+}
+
+// hold keeps a Sale until the account is flushed, noting it if it is a loss
+func (a *Account) hold(s *Sale) {
+	a.held = append(a.held, s)
+	if loss := s.FifoCost.Sub(s.Proceeds); loss.GreaterThan(decimal.Zero) && !s.Pooled {
+		a.losses = append(a.losses, &washLoss{sale: s, loss: loss, remaining: s.Quantity})
+	}
+}
+
+// separate splits quantity shares of the lot at index i off into a lot of
+// their own, placed before it, and returns it
+func (h *LotHistory) separate(i int, quantity decimal.Decimal) (*Lot, error) {
+	if quantity.GreaterThanOrEqual(h.Lots[i].Quantity) {
+		return h.Lots[i], nil
+	}
+	part, err := h.split(i, quantity)
+	if err != nil {
+		return nil, err
+	}
+	h.Lots = append(h.Lots[:i], append([]*Lot{part}, h.Lots[i:]...)...)
+	return part, nil
+}
+
+// washSales applies the wash sale rule to the losses whose shares were
+// replaced by shares bought within 30 days before or after the loss.  The
+// loss on as many shares as were replaced is disallowed and added to the
+// basis of the replacement shares, whose holding period also includes that
+// of the shares sold.  Shares bought together with the shares sold, and
+// shares that already replaced others, are not replacements.  now is the
+// time of the transaction just processed, after which losses more than 30
+// days old can no longer be replaced.
+func (a *Account) washSales(now time.Time) error {
+	pending := a.losses[:0]
+	for _, loss := range a.losses {
+		s := loss.sale
+		start := day(s.SaleDate).AddDate(0, 0, -30)
+		end := day(s.SaleDate).AddDate(0, 0, 31)
+
+		if history, ok := a.Holdings[s.Asset].(*LotHistory); ok {
+			for i := 0; i < len(history.Lots) && loss.remaining.GreaterThan(decimal.Zero); i++ {
+				lot := history.Lots[i]
+				if lot.Replacement || lot.PurchaseDate.Before(start) || !lot.PurchaseDate.Before(end) || lot.PurchaseDate.Equal(s.PurchaseDate) {
+					continue
+				}
+
+				replacement, err := history.separate(i, loss.remaining)
+				if err != nil {
+					return err
+				}
+				disallowed := share(loss.loss, replacement.Quantity, s.Quantity)
+				replacement.Adjustment = replacement.Adjustment.Add(disallowed)
+				replacement.HoldingSince = replacement.holdingSince().Add(-s.SaleDate.Sub(s.holdingSince()))
+				replacement.Replacement = true
+
+				s.DisallowedLoss = s.DisallowedLoss.Add(disallowed)
+				loss.remaining = loss.remaining.Sub(replacement.Quantity)
+			}
+		}
+
+		if loss.remaining.GreaterThan(decimal.Zero) && now.Before(end) {
+			pending = append(pending, loss)
+		}
+	}
+	a.losses = pending
+	return nil
+}
@@ -0,0 +1,123 @@
+package accounting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountWashSales(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time {
+		return t0.AddDate(0, 0, n)
+	}
+
+	account := NewAccount()
+	account.WashSales = true
+
+	sales := make(chan *Sale, 10)
+	for _, tr := range []Transaction{
+		// A loss replaced by fewer shares 10 days later
+		trade(day(0), BUY, 10, 100),
+		trade(day(40), SELL, 10, 80),
+		trade(day(50), BUY, 4, 85),
+		trade(day(60), SELL, 4, 110),
+		// A loss replaced by shares bought 5 days before
+		trade(day(100), BUY, 5, 100),
+		trade(day(120), BUY, 5, 90),
+		trade(day(125), SELL, 5, 70),
+		// A loss that is not replaced within 30 days
+		trade(day(200), SELL, 1, 60),
+		trade(day(231), BUY, 1, 50),
+	} {
+		tr := tr
+		assert.Nil(t, account.ProcessTransaction(&tr, sales, nil))
+	}
+
+	// Sales are held until the account is flushed
+	assert.Equal(t, 0, len(sales))
+	assert.Nil(t, account.Flush(sales))
+	close(sales)
+
+	result := make([]*Sale, 0)
+	for s := range sales {
+		result = append(result, s)
+	}
+	if !assert.Equal(t, 4, len(result)) {
+		return
+	}
+
+	assert.Equal(t, "-200", result[0].Proceeds.Sub(result[0].FifoCost).String())
+	assert.Equal(t, "80", result[0].DisallowedLoss.String())
+	assert.Equal(t, "-120", result[0].Gain().String())
+
+	// The replacement shares have the basis and holding period of the
+	// shares sold
+	assert.Equal(t, day(50), result[1].PurchaseDate)
+	assert.Equal(t, day(10), result[1].HoldingSince)
+	assert.Equal(t, "420", result[1].FifoCost.String())
+	assert.Equal(t, "20", result[1].Gain().String())
+
+	assert.Equal(t, "150", result[2].DisallowedLoss.String())
+	assert.Equal(t, "0", result[2].Gain().String())
+
+	// A loss on replacement shares is not disallowed when nothing replaces
+	// them within 30 days
+	assert.Equal(t, "120", result[3].FifoCost.String())
+	assert.True(t, result[3].DisallowedLoss.IsZero())
+
+	// The rest of the replacement shares of the second loss are still held
+	h := account.Holdings["BTC"].(*LotHistory)
+	if assert.Equal(t, 2, len(h.Lots)) {
+		assert.Equal(t, day(120), h.Lots[0].PurchaseDate)
+		assert.Equal(t, day(95), h.Lots[0].HoldingSince)
+		assert.Equal(t, "480", h.Lots[0].TotalCost().String())
+		assert.True(t, h.Lots[0].Replacement)
+		assert.False(t, h.Lots[1].Replacement)
+	}
+}
+
+func TestAccountWashSaleDesignation(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time {
+		return t0.AddDate(0, 0, n)
+	}
+
+	account := NewAccount()
+	account.WashSales = true
+	// The replacement shares are still designated by their purchase date
+	account.Method = SpecificIdentification{{SaleDate: day(60), PurchaseDate: day(20)}}
+
+	sales := make(chan *Sale, 10)
+	for _, tr := range []Transaction{
+		trade(day(0), BUY, 10, 100),
+		trade(day(20), BUY, 5, 50),
+		trade(day(40), SELL, 5, 80),
+		trade(day(60), SELL, 5, 90),
+	} {
+		tr := tr
+		assert.Nil(t, account.ProcessTransaction(&tr, sales, nil))
+	}
+	assert.Nil(t, account.Flush(sales))
+	close(sales)
+
+	result := make([]*Sale, 0)
+	for s := range sales {
+		result = append(result, s)
+	}
+	if !assert.Equal(t, 2, len(result)) {
+		return
+	}
+
+	assert.Equal(t, "100", result[0].DisallowedLoss.String())
+	assert.Equal(t, day(20), result[1].PurchaseDate)
+	assert.Equal(t, day(-20), result[1].HoldingSince)
+	assert.Equal(t, "350", result[1].FifoCost.String())
+
+	// The shares left are those bought first
+	h := account.Holdings["BTC"].(*LotHistory)
+	if assert.Equal(t, 1, len(h.Lots)) {
+		assert.Equal(t, day(0), h.Lots[0].PurchaseDate)
+	}
+}
@@ -1,24 +1,333 @@
 package main
 
 import (
+	"encoding/csv"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/shopspring/decimal"
 	log "github.com/sirupsen/logrus"
 	"github.com/sklarsa/crypto-taxes/accounting"
 	"github.com/sklarsa/crypto-taxes/parser"
+	"github.com/sklarsa/crypto-taxes/prices"
+	"github.com/sklarsa/crypto-taxes/report"
 )
 
 func usage() {
-	fmt.Printf("Usage: %s [OPTIONS] filename.csv\n", os.Args[0])
+	fmt.Printf("Usage: %s [OPTIONS] filename.csv [filename.csv ...]\n", os.Args[0])
+	fmt.Println("Use - as a filename to read from stdin")
 	flag.PrintDefaults()
 }
 
+// parseMethod returns the LotSelectionMethod for a name, using designations
+// for the specific method
+func parseMethod(name string, designations accounting.SpecificIdentification) (accounting.LotSelectionMethod, error) {
+	if !strings.EqualFold(strings.TrimSpace(name), "specific") {
+		return accounting.ParseLotSelectionMethod(name)
+	}
+	if designations == nil {
+		return nil, fmt.Errorf("The specific method requires a -designations file")
+	}
+	return designations, nil
+}
+
+// parseAssetMethods parses a comma-separated list of ASSET=method pairs
+func parseAssetMethods(value string, designations accounting.SpecificIdentification) (map[string]accounting.LotSelectionMethod, error) {
+	methods := make(map[string]accounting.LotSelectionMethod)
+	if value == "" {
+		return methods, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return methods, fmt.Errorf("Invalid asset method '%s', expected ASSET=method", pair)
+		}
+		method, err := parseMethod(parts[1], designations)
+		if err != nil {
+			return methods, err
+		}
+		methods[strings.TrimSpace(parts[0])] = method
+	}
+	return methods, nil
+}
+
+// readDesignations reads a csv file of "sale date,purchase date" rows in
+// RFC3339 format for specific identification, optionally preceded by the
+// asset they apply to
+func readDesignations(filename string) (accounting.SpecificIdentification, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	designations := make(accounting.SpecificIdentification, 0)
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return designations, err
+		}
+		asset := ""
+		if len(record) == 3 {
+			asset, record = strings.TrimSpace(record[0]), record[1:]
+		}
+		if len(record) != 2 {
+			return designations, fmt.Errorf("Invalid designation %v, expected an optional asset, sale date and purchase date", record)
+		}
+
+		saleDate, err := time.Parse(time.RFC3339, strings.TrimSpace(record[0]))
+		if err != nil {
+			return designations, fmt.Errorf("Invalid sale date %s", record[0])
+		}
+		purchaseDate, err := time.Parse(time.RFC3339, strings.TrimSpace(record[1]))
+		if err != nil {
+			return designations, fmt.Errorf("Invalid purchase date %s", record[1])
+		}
+
+		designations = append(designations, accounting.Designation{
+			Asset:        asset,
+			SaleDate:     saleDate,
+			PurchaseDate: purchaseDate,
+		})
+	}
+	return designations, nil
+}
+
+// readFile reads the transactions of a file, or of stdin if filename is -
+func readFile(read parser.Reader, filename string) ([]*accounting.Transaction, error) {
+	if filename == "-" {
+		return read(os.Stdin)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return make([]*accounting.Transaction, 0), err
+	}
+	defer file.Close()
+
+	return read(file)
+}
+
+// readOpeningLots reads the opening lots saved by a previous run
+func readOpeningLots(filename string) (*accounting.Snapshot, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return accounting.ReadSnapshot(file)
+}
+
+// saveLots saves the lots held by the account as of asOf to a file
+func saveLots(account *accounting.Account, asOf time.Time, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return account.Snapshot(asOf).Write(file)
+}
+
+// formatOriginal describes the cost and proceeds of a sale in the
+// currencies it was bought and sold in, when they were converted
+func formatOriginal(s *accounting.Sale) string {
+	if (s.CostCurrency == "" || s.CostCurrency == s.Currency) && (s.ProceedsCurrency == "" || s.ProceedsCurrency == s.Currency) {
+		return ""
+	}
+	return fmt.Sprintf(" (cost %s, proceeds %s)", formatMoney(s.OriginalCost, s.CostCurrency), formatMoney(s.OriginalProceeds, s.ProceedsCurrency))
+}
+
+// formatPurchaseDate formats the purchase date of a sale, using pooled for
+// sales matched against a pool
+func formatPurchaseDate(s *accounting.Sale, pooled string) string {
+	if s.PurchaseDate.IsZero() {
+		return pooled
+	}
+	return s.PurchaseDate.Format("2006-01-02")
+}
+
+// failure is a transaction that could not be processed, and why
+type failure struct {
+	t   *accounting.Transaction
+	err error
+}
+
+// markSends changes the Sends at the given comma-separated RFC3339
+// timestamps, or every Send if value is "all", into action, such as SELL for
+// disposals or GIFT_OUT for gifts
+func markSends(transactions []*accounting.Transaction, value string, action accounting.Action) error {
+	if value == "" {
+		return nil
+	}
+
+	dates := make([]time.Time, 0)
+	if value != "all" {
+		for _, s := range strings.Split(value, ",") {
+			date, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("Invalid %s date %s", action, s)
+			}
+			dates = append(dates, date)
+		}
+	}
+
+	for _, t := range transactions {
+		if t.Action != accounting.TRANSFER_OUT {
+			continue
+		}
+		if value == "all" {
+			t.Action = action
+			continue
+		}
+		for _, date := range dates {
+			if t.Timestamp.Equal(date) {
+				t.Action = action
+			}
+		}
+	}
+	return nil
+}
+
+// formatMoney formats an amount rounded to cents, using a $ sign for USD
+// and the currency code otherwise
+func formatMoney(amount decimal.Decimal, currency string) string {
+	if currency == "" || currency == "USD" {
+		return "$" + amount.Round(2).String()
+	}
+	return amount.Round(2).String() + " " + currency
+}
+
+// formatSubtotals summarizes the gains of each term.  Pools have no holding
+// period, so their sales are subtotalled together instead.
+func formatSubtotals(gains map[accounting.Term]decimal.Decimal, model accounting.BasisModel, currency string) string {
+	if model != accounting.LOTS {
+		return fmt.Sprintf("Pooled P&L: %s\n", formatMoney(gains[accounting.POOLED], currency))
+	}
+	return fmt.Sprintf("Short-term P&L: %s\nLong-term P&L: %s\n", formatMoney(gains[accounting.SHORT_TERM], currency), formatMoney(gains[accounting.LONG_TERM], currency))
+}
+
+// incomeReport returns a string summarizing income per asset and month,
+// with totals per asset and overall
+func incomeReport(income []*accounting.Income, currency string) string {
+	header := "Income Summary"
+	report := strings.Repeat("-", len(header)) + "\n"
+	report += header + "\n" + strings.Repeat("-", len(header)) + "\n"
+
+	type key struct {
+		asset string
+		month string
+	}
+	quantities := make(map[key]decimal.Decimal)
+	values := make(map[key]decimal.Decimal)
+	keys := make([]key, 0)
+	for _, i := range income {
+		k := key{i.Asset, i.Date.Format("2006-01")}
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		quantities[k] = quantities[k].Add(i.Quantity)
+		values[k] = values[k].Add(i.Value())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].asset != keys[j].asset {
+			return keys[i].asset < keys[j].asset
+		}
+		return keys[i].month < keys[j].month
+	})
+
+	total := decimal.Zero
+	assetTotal := decimal.Zero
+	for n, k := range keys {
+		report += fmt.Sprintf("%s %s: %s (%s)\n", k.month, k.asset, quantities[k], formatMoney(values[k], currency))
+		assetTotal = assetTotal.Add(values[k])
+		total = total.Add(values[k])
+		if n == len(keys)-1 || keys[n+1].asset != k.asset {
+			report += fmt.Sprintf("Total %s: %s\n", k.asset, formatMoney(assetTotal, currency))
+			assetTotal = decimal.Zero
+		}
+	}
+	report += fmt.Sprintf("Total income: %s\n", formatMoney(total, currency))
+	return report
+}
+
+// giftExclusions are the US gift tax annual exclusions per recipient by year
+var giftExclusions = map[int]int64{
+	2018: 15000,
+	2019: 15000,
+	2020: 15000,
+	2021: 15000,
+	2022: 16000,
+	2023: 17000,
+	2024: 18000,
+	2025: 19000,
+	2026: 19000,
+}
+
+// giftReport returns a string summarizing the value of gifts given per year
+// and recipient.  In USD, totals over the annual exclusion are marked, as
+// they need a gift tax return.
+func giftReport(gifts []*accounting.Gift, currency string) string {
+	header := "Gift Summary"
+	report := strings.Repeat("-", len(header)) + "\n"
+	report += header + "\n" + strings.Repeat("-", len(header)) + "\n"
+
+	type key struct {
+		year      int
+		recipient string
+	}
+	values := make(map[key]decimal.Decimal)
+	keys := make([]key, 0)
+	for _, g := range gifts {
+		report += fmt.Sprintf("%s: Gave %s of %s worth %s with a basis of %s to %s\n", g.Date.Format("2006-01-02"), g.Quantity, g.Asset, formatMoney(g.Value(), currency), formatMoney(g.Basis(), currency), recipient(g))
+
+		k := key{g.Date.Year(), recipient(g)}
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		values[k] = values[k].Add(g.Value())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].year != keys[j].year {
+			return keys[i].year < keys[j].year
+		}
+		return keys[i].recipient < keys[j].recipient
+	})
+
+	for _, k := range keys {
+		report += fmt.Sprintf("Total %d to %s: %s", k.year, k.recipient, formatMoney(values[k], currency))
+		exclusion, ok := giftExclusions[k.year]
+		if ok && (currency == "" || currency == "USD") && values[k].GreaterThan(decimal.NewFromInt(exclusion)) {
+			report += fmt.Sprintf(" (over the %s annual exclusion)", formatMoney(decimal.NewFromInt(exclusion), currency))
+		}
+		report += "\n"
+	}
+	return report
+}
+
+// recipient returns the recipient of a gift, which may not be known
+func recipient(g *accounting.Gift) string {
+	if g.Recipient == "" {
+		return "unknown"
+	}
+	return g.Recipient
+}
+
 func main() {
-	badTransactions := make(chan *accounting.Transaction)
+	badTransactions := make(chan *failure)
 	sales := make(chan *accounting.Sale)
+	incomeEvents := make(chan *accounting.Income)
 
 	flag.Usage = usage
 
@@ -28,54 +337,297 @@ func main() {
 	var csvOutput bool
 	flag.BoolVar(&csvOutput, "csv", false, "Output results in turbotax csv format")
 
+	var txf bool
+	flag.BoolVar(&txf, "txf", false, "Output results in TXF format for TurboTax desktop")
+
+	var form8949 bool
+	flag.BoolVar(&form8949, "8949", false, "Output results as IRS Form 8949 rows with Schedule D totals in csv format")
+
 	var year int
 	flag.IntVar(&year, "y", 0, "Only output sales for a specified year")
 
+	var methodName string
+	flag.StringVar(&methodName, "method", "fifo", "Lot selection method: fifo, lifo, hifo or specific")
+
+	var assetMethods string
+	flag.StringVar(&assetMethods, "asset-method", "", "Comma-separated per-asset lot selection methods, e.g. BTC=hifo,ETH=specific")
+
+	var format string
+	flag.StringVar(&format, "format", "auto", "Input file format: auto (detect the format of each file), coinbase, coinbasepro, kraken (ledgers.csv), krakentrades (trades.csv), binance (trade history), binancehistory (transaction history), gemini, etherscan, electrum, sparrow or ledgerlive")
+
+	var mappingFile string
+	flag.StringVar(&mappingFile, "mapping", "", "JSON file describing the columns of a csv export, used instead of -format")
+
+	var addresses string
+	flag.StringVar(&addresses, "addresses", "", "Comma-separated addresses owned, for etherscan exports (defaults to the address each export is for)")
+
+	var basis string
+	flag.StringVar(&basis, "basis", "lots", "Cost basis model: lots, s104 (UK Section 104 pool) or acb (Canadian adjusted cost base)")
+
+	var disposals string
+	flag.StringVar(&disposals, "disposals", "", "Comma-separated RFC3339 timestamps of sends to treat as sales, or 'all'")
+
+	var gifts string
+	flag.StringVar(&gifts, "gifts", "", "Comma-separated RFC3339 timestamps of sends to treat as gifts given, or 'all'")
+
+	var designationsFile string
+	flag.StringVar(&designationsFile, "designations", "", "CSV of '[asset,]sale date,purchase date' rows (RFC3339) used by the specific method")
+
+	var pricesDir string
+	flag.StringVar(&pricesDir, "prices", "", "Directory of price history csv files (e.g. BTC.csv, ETH-EUR.csv) used to value transactions without a spot price")
+
+	var interpolation string
+	flag.StringVar(&interpolation, "interpolation", "nearest", "How prices are found between the times of a price history: nearest, previous or linear")
+
+	var priceTolerance time.Duration
+	flag.DurationVar(&priceTolerance, "price-tolerance", 24*time.Hour, "How far from the nearest price in a price history a price is found")
+
+	var washSales bool
+	flag.BoolVar(&washSales, "wash-sales", false, "Simulate the US wash sale rule, disallowing losses on shares replaced within 30 days")
+
+	var currency string
+	flag.StringVar(&currency, "currency", "", "Currency to report gains in, e.g. EUR (defaults to the currency of the first transaction)")
+
+	var ratesFile string
+	flag.StringVar(&ratesFile, "rates", "", "ECB euro reference rates csv (eurofxref-hist.csv) used to convert transactions to the -currency")
+
+	var openingLotsFile string
+	flag.StringVar(&openingLotsFile, "opening-lots", "", "JSON file of lots saved with -save-lots to start from, skipping the transactions before it")
+
+	var saveLotsFile string
+	flag.StringVar(&saveLotsFile, "save-lots", "", "Save the lots held at the end of the -y year to a JSON file, to be used with -opening-lots")
+
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	if flag.NArg() < 1 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if txf && form8949 {
+		log.Fatal("-txf and -8949 cannot be used together")
+	}
+
 	if verbose {
 		log.SetLevel(log.DebugLevel)
 	}
-	filename := flag.Arg(0)
 
-	transactions, err := parser.ReadStandardFile(filename)
-	if err != nil {
-		log.Panic(err)
+	if addresses != "" {
+		parser.Readers["etherscan"] = parser.Etherscan{Addresses: strings.Split(addresses, ",")}.Read
+	}
+
+	if _, ok := parser.Readers[format]; !ok && format != "auto" {
+		log.Fatalf("Unknown format '%s'", format)
+	}
+	read := func(r io.Reader) ([]*accounting.Transaction, error) {
+		return parser.ReadFormat(format, r)
+	}
+	if format == "auto" {
+		read = parser.ReadAuto
+	}
+	if mappingFile != "" {
+		mapping, err := parser.LoadMapping(mappingFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		read = mapping.Read
+	}
+
+	sources := make([][]*accounting.Transaction, 0, flag.NArg())
+	for _, filename := range flag.Args() {
+		source, err := readFile(read, filename)
+		if err != nil {
+			log.Fatalf("%s: %s", filename, err)
+		}
+		sources = append(sources, source)
+	}
+
+	transactions, dropped := parser.Merge(sources...)
+	for _, t := range dropped {
+		os.Stderr.WriteString(
+			fmt.Sprintf("Dropped duplicate %s %s of %s %s\n", t.Timestamp.Format(time.RFC3339), t.Action, t.Quantity, t.Asset),
+		)
+	}
+
+	if err := markSends(transactions, disposals, accounting.SELL); err != nil {
+		log.Fatal(err)
+	}
+	if err := markSends(transactions, gifts, accounting.GIFT_OUT); err != nil {
+		log.Fatal(err)
 	}
 
-	sort.Slice(transactions, func(i, j int) bool {
-		return transactions[i].Timestamp.Unix() < transactions[j].Timestamp.Unix()
-	})
 	account := accounting.NewAccount()
 
+	var err error
+	account.Model, err = accounting.ParseBasisModel(basis)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var designations accounting.SpecificIdentification
+	if designationsFile != "" {
+		designations, err = readDesignations(designationsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	account.Method, err = parseMethod(methodName, designations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	account.AssetMethods, err = parseAssetMethods(assetMethods, designations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if (form8949 || txf) && account.Model != accounting.LOTS {
+		log.Fatal("-8949 and -txf require the lots basis model, as pooled sales have no holding period")
+	}
+
+	if washSales && account.Model != accounting.LOTS {
+		log.Fatal("-wash-sales requires the lots basis model")
+	}
+	account.WashSales = washSales
+
+	account.Currency = strings.ToUpper(currency)
+	if ratesFile != "" {
+		account.Rates, err = prices.LoadECBRates(ratesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if pricesDir != "" {
+		files, err := prices.LoadFiles(pricesDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files.Interpolation, err = prices.ParseInterpolation(interpolation)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files.Tolerance = priceTolerance
+		account.Prices = files
+	}
+
+	if openingLotsFile != "" {
+		opening, err := readOpeningLots(openingLotsFile)
+		if err != nil {
+			log.Fatalf("%s: %s", openingLotsFile, err)
+		}
+		if err := account.Open(opening); err != nil {
+			log.Fatalf("%s: %s", openingLotsFile, err)
+		}
+
+		// The opening lots already account for every earlier transaction
+		skipped := 0
+		for len(transactions) > skipped && transactions[skipped].Timestamp.Before(opening.AsOf) {
+			skipped++
+		}
+		if skipped > 0 {
+			os.Stderr.WriteString(fmt.Sprintf("Skipped %d transactions before the opening lots as of %s\n", skipped, opening.AsOf.Format(time.RFC3339)))
+		}
+		transactions = transactions[skipped:]
+	}
+
+	// Transactions without a price, such as trades between two cryptos or
+	// fees paid in a third asset, can only be valued with a price history
+	if pricesDir == "" {
+		for _, t := range transactions {
+			if assets := t.Unpriced(); len(assets) > 0 {
+				log.Fatalf("The %s of %s %s on %s has no price of %s; use -prices with a price history of it", t.Action, t.Quantity, t.Asset, t.Timestamp.Format(time.RFC3339), strings.Join(assets, " or "))
+			}
+		}
+	}
+
+	// The lots are saved as of the start of the following year, before any
+	// of its transactions are processed
+	var yearEnd time.Time
+	if saveLotsFile != "" {
+		if year == 0 {
+			log.Fatal("-save-lots requires a year, given with -y")
+		}
+		yearEnd = time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	saveYearEnd := func() {
+		if err := saveLots(account, yearEnd, saveLotsFile); err != nil {
+			log.Fatal(err)
+		}
+		saveLotsFile = ""
+	}
+
 	go func() {
 		defer close(sales)
 		defer close(badTransactions)
+		defer close(incomeEvents)
 
 		for _, t := range transactions {
-			err := account.ProcessTransaction(t, sales)
+			if saveLotsFile != "" && !t.Timestamp.Before(yearEnd) {
+				saveYearEnd()
+			}
+
+			err := account.ProcessTransaction(t, sales, incomeEvents)
 			if err != nil {
-				badTransactions <- t
+				badTransactions <- &failure{t, err}
 				continue
 			}
 		}
+
+		if err := account.Flush(sales); err != nil {
+			log.Error(err)
+		}
+		if saveLotsFile != "" {
+			saveYearEnd()
+		}
 	}()
 
 	go func() {
-		for t := range badTransactions {
+		for f := range badTransactions {
 			os.Stderr.WriteString(
-				fmt.Sprintf("\033[0;31mError processing %s sale of %s %s\033[0m\n", t.Timestamp.Format("2006-01-02"), t.Quantity, t.Asset),
+				fmt.Sprintf("\033[0;31mError processing %s %s of %s %s: %s\033[0m\n", f.t.Timestamp.Format("2006-01-02"), f.t.Action, f.t.Quantity, f.t.Asset, f.err),
 			)
 		}
 	}()
 
+	income := make([]*accounting.Income, 0)
+	incomeDone := make(chan struct{})
+	go func() {
+		defer close(incomeDone)
+		for i := range incomeEvents {
+			if year > 0 && i.Date.Year() != year {
+				continue
+			}
+			income = append(income, i)
+		}
+	}()
+
+	gains := make(map[accounting.Term]decimal.Decimal)
+
+	if form8949 || txf {
+		yearSales := make([]*accounting.Sale, 0)
+		for s := range sales {
+			if year > 0 && s.SaleDate.Year() != year {
+				continue
+			}
+			yearSales = append(yearSales, s)
+		}
+		<-incomeDone
+
+		if txf {
+			err = report.WriteTXF(os.Stdout, yearSales, time.Now())
+		} else {
+			err = report.WriteForm8949(os.Stdout, yearSales)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if csvOutput {
-		fmt.Println("\"Currency Name\",\"Purchase Date\",\"Cost Basis\",\"Date Sold\",\"Proceeds\"")
+		fmt.Println("\"Currency Name\",\"Purchase Date\",\"Cost Basis\",\"Date Sold\",\"Proceeds\",\"Term\"")
 	}
 	for s := range sales {
 		// Skip transaction if year flag is set and transaction is not in the specified year
@@ -84,14 +636,37 @@ func main() {
 		}
 
 		cost := s.FifoCost
+		gains[s.Term()] = gains[s.Term()].Add(s.Gain())
 		if csvOutput {
-			fmt.Printf("\"%s\",%s,%s,%s,%s\n", s.Asset, s.PurchaseDate.Format("2006-01-02"), cost, s.SaleDate.Format("2006-01-02"), s.Proceeds)
+			fmt.Printf("\"%s\",%s,%s,%s,%s,%s\n", s.Asset, formatPurchaseDate(s, "VARIOUS"), cost, s.SaleDate.Format("2006-01-02"), s.Proceeds, s.Term())
 		} else {
-			fmt.Printf("%s: Sold %s of %s with P&L of $%s purchased on %s\n", s.SaleDate.Format("2006-01-02"), s.Quantity, s.Asset, s.Proceeds.Sub(cost).Round(2), s.PurchaseDate.Format("2006-01-02"))
+			fmt.Printf("%s: Sold %s of %s with %s P&L of %s purchased on %s%s\n", s.SaleDate.Format("2006-01-02"), s.Quantity, s.Asset, s.Term(), formatMoney(s.Gain(), s.Currency), formatPurchaseDate(s, "pool"), formatOriginal(s))
 		}
 
 	}
+	<-incomeDone
+
+	subtotals := formatSubtotals(gains, account.Model, account.Currency)
+	if csvOutput {
+		// Keep stdout a valid csv file
+		os.Stderr.WriteString(subtotals)
+	} else {
+		fmt.Println("\n" + subtotals)
+	}
+
 	if !csvOutput {
+		if len(income) > 0 {
+			fmt.Println("\n" + incomeReport(income, account.Currency))
+		}
+		yearGifts := make([]*accounting.Gift, 0, len(account.Gifts))
+		for _, g := range account.Gifts {
+			if year == 0 || g.Date.Year() == year {
+				yearGifts = append(yearGifts, g)
+			}
+		}
+		if len(yearGifts) > 0 {
+			fmt.Println("\n" + giftReport(yearGifts, account.Currency))
+		}
 		fmt.Println("\n" + account.Report())
 	}
 
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSubtotalsSameDay(t *testing.T) {
+	account := accounting.NewAccount()
+	account.Model = accounting.SECTION_104
+	account.Currency = "GBP"
+
+	t0 := time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC)
+	transactions := []accounting.Transaction{
+		{Timestamp: t0, Action: accounting.BUY, Asset: "BTC", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(100), Currency: "GBP"},
+		{Timestamp: t0.AddDate(0, 1, 0), Action: accounting.BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(150), Currency: "GBP"},
+		{Timestamp: t0.AddDate(0, 1, 0).Add(time.Hour), Action: accounting.SELL, Asset: "BTC", Quantity: decimal.NewFromInt(2), Spot: decimal.NewFromInt(200), Currency: "GBP"},
+	}
+
+	sales := make(chan *accounting.Sale)
+	go func() {
+		defer close(sales)
+		for i := range transactions {
+			assert.Nil(t, account.ProcessTransaction(&transactions[i], sales, nil))
+		}
+		assert.Nil(t, account.Flush(sales))
+	}()
+
+	gains := make(map[accounting.Term]decimal.Decimal)
+	count := 0
+	for s := range sales {
+		gains[s.Term()] = gains[s.Term()].Add(s.Gain())
+		count++
+	}
+
+	// The same-day match and the match against the pool are both pooled
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "Pooled P&L: 150 GBP\n", formatSubtotals(gains, account.Model, account.Currency))
+}
+
+func TestParseAssetMethods(t *testing.T) {
+	designations := accounting.SpecificIdentification{{Asset: "BTC"}}
+	methods, err := parseAssetMethods("BTC=specific, ETH=hifo", designations)
+	assert.Nil(t, err)
+	assert.Equal(t, designations, methods["BTC"])
+	assert.Equal(t, accounting.HIFO{}, methods["ETH"])
+
+	// The specific method needs designations
+	_, err = parseAssetMethods("BTC=specific", nil)
+	assert.Error(t, err)
+}
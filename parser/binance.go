@@ -0,0 +1,335 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// binanceQuotes are the quote assets found at the end of Binance pairs,
+// longest first so that e.g. USDT is matched before USD
+var binanceQuotes = []string{"FDUSD", "USDT", "BUSD", "USDC", "TUSD", "USD", "EUR", "GBP", "AUD", "TRY", "BTC", "ETH", "BNB", "DAI"}
+
+// binancePair splits a Binance pair such as BTCUSDT or ETH/BTC into its
+// base and quote assets
+func binancePair(pair string) (string, string, error) {
+	pair = strings.ToUpper(strings.TrimSpace(pair))
+	for _, separator := range []string{"/", "-", "_"} {
+		if parts := strings.Split(pair, separator); len(parts) == 2 {
+			return parts[0], parts[1], nil
+		}
+	}
+	for _, quote := range binanceQuotes {
+		if strings.HasSuffix(pair, quote) && len(pair) > len(quote) {
+			return strings.TrimSuffix(pair, quote), quote, nil
+		}
+	}
+	return "", "", fmt.Errorf("Unrecognized Binance pair %s", pair)
+}
+
+// binanceUnit matches an amount followed by its asset, e.g. "0.001BTC"
+var binanceUnit = regexp.MustCompile(`^([-\d.,]+)\s*([A-Za-z][A-Za-z0-9]*)$`)
+
+// binanceAmount parses an amount that may be followed by its asset, such as
+// "0.001BTC", returning the amount and the asset.  The assets of the pair
+// are tried first, as asset names may start with a digit (e.g. 1INCH).
+func binanceAmount(value string, assets ...string) (decimal.Decimal, string, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	number, asset := value, ""
+	for _, candidate := range assets {
+		if candidate != "" && strings.HasSuffix(value, candidate) {
+			number, asset = strings.TrimSuffix(value, candidate), candidate
+			break
+		}
+	}
+	if asset == "" {
+		if match := binanceUnit.FindStringSubmatch(value); match != nil {
+			number, asset = match[1], match[2]
+		}
+	}
+
+	amount, err := decimal.NewFromString(strings.ReplaceAll(strings.TrimSpace(number), ",", ""))
+	if number == "" {
+		amount, err = decimal.Zero, nil
+	}
+	if err != nil {
+		return amount, asset, fmt.Errorf("Invalid amount %s", value)
+	}
+	return amount, asset, nil
+}
+
+// ReadBinanceTrades reads a Binance or Binance.US spot trade history export
+// from r.  Binance exports have no transaction ids, so the Transactions have
+// none.  Both the current layout (Date(UTC), Pair, Side, Price, Executed,
+// Amount, Fee), whose amounts are followed by their asset, and the older
+// layout (Date(UTC), Market, Type, Price, Amount, Total, Fee, Fee Coin) are
+// read.
+func ReadBinanceTrades(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.index("Date(UTC)", "Date") >= 0 && h.index("Pair", "Market") >= 0 && h.index("Side", "Type") >= 0
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	// The older layout calls the executed quantity Amount, and the quote
+	// amount Total
+	quantityCol, totalCol := h.index("Executed"), h.index("Amount")
+	if quantityCol < 0 {
+		quantityCol, totalCol = h.index("Amount"), h.index("Total")
+	}
+	if quantityCol < 0 || totalCol < 0 {
+		return transactions, fmt.Errorf("Missing heading 'Executed'")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		base, quote, err := binancePair(field(record, h.index("Pair", "Market")))
+		if err != nil {
+			return transactions, err
+		}
+		timestamp, err := parseTimestamp(field(record, h.index("Date(UTC)", "Date")))
+		if err != nil {
+			return transactions, err
+		}
+
+		quantity, _, err := binanceAmount(field(record, quantityCol), base)
+		if err != nil {
+			return transactions, err
+		}
+		total, _, err := binanceAmount(field(record, totalCol), quote)
+		if err != nil {
+			return transactions, err
+		}
+		feeQuantity, feeAsset, err := binanceAmount(field(record, h.index("Fee")), base, quote, "BNB")
+		if err != nil {
+			return transactions, err
+		}
+		if coin := field(record, h.index("Fee Coin")); coin != "" {
+			feeAsset = strings.ToUpper(coin)
+		}
+		fee := leg{feeAsset, feeQuantity.Abs()}
+		if fee.quantity.IsZero() {
+			fee.asset = ""
+		}
+
+		baseLeg, quoteLeg := leg{base, quantity.Abs()}, leg{quote, total.Abs()}
+
+		var t *a.Transaction
+		switch strings.ToUpper(field(record, h.index("Side", "Type"))) {
+		case "BUY":
+			t = tradeTransaction(timestamp, quoteLeg, baseLeg, fee)
+		case "SELL":
+			t = tradeTransaction(timestamp, baseLeg, quoteLeg, fee)
+		default:
+			return transactions, fmt.Errorf("Invalid side %s on %s", field(record, h.index("Side", "Type")), field(record, h.index("Date(UTC)", "Date")))
+		}
+		if t != nil {
+			transactions = append(transactions, t)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+	return transactions, nil
+}
+
+// binanceOperation is how a Binance transaction history operation is read
+type binanceOperation int
+
+const (
+	binanceIgnored binanceOperation = iota
+	binanceTradeLeg
+	binanceFee
+	binanceDeposit
+	binanceWithdrawal
+	binanceIncome
+)
+
+// binanceOperations maps Binance transaction history operations to how
+// they are read.  Moves between Binance wallets, such as subscribing to
+// Simple Earn, are not transactions and are ignored.
+var binanceOperations = map[string]binanceOperation{
+	"buy":                                      binanceTradeLeg,
+	"sell":                                     binanceTradeLeg,
+	"transaction related":                      binanceTradeLeg,
+	"transaction buy":                          binanceTradeLeg,
+	"transaction spend":                        binanceTradeLeg,
+	"transaction sold":                         binanceTradeLeg,
+	"transaction revenue":                      binanceTradeLeg,
+	"binance convert":                          binanceTradeLeg,
+	"large otc trading":                        binanceTradeLeg,
+	"small assets exchange bnb":                binanceTradeLeg,
+	"fee":                                      binanceFee,
+	"transaction fee":                          binanceFee,
+	"deposit":                                  binanceDeposit,
+	"withdraw":                                 binanceWithdrawal,
+	"withdrawal":                               binanceWithdrawal,
+	"distribution":                             binanceIncome,
+	"airdrop assets":                           binanceIncome,
+	"commission history":                       binanceIncome,
+	"referral kickback":                        binanceIncome,
+	"staking rewards":                          binanceIncome,
+	"eth 2.0 staking rewards":                  binanceIncome,
+	"pos savings interest":                     binanceIncome,
+	"savings interest":                         binanceIncome,
+	"launchpool interest":                      binanceIncome,
+	"simple earn flexible interest":            binanceIncome,
+	"simple earn locked rewards":               binanceIncome,
+	"simple earn flexible subscription":        binanceIgnored,
+	"simple earn flexible redemption":          binanceIgnored,
+	"simple earn locked subscription":          binanceIgnored,
+	"simple earn locked redemption":            binanceIgnored,
+	"staking purchase":                         binanceIgnored,
+	"staking redemption":                       binanceIgnored,
+	"transfer between main and funding wallet": binanceIgnored,
+}
+
+// ReadBinanceTransactions reads a Binance transaction history export
+// (UTC_Time, Account, Operation, Coin, Change) from r.  The balance changes
+// of a trade share their time, and are joined into a single Transaction.
+// Deposits and withdrawals become transfers, and interest, staking rewards
+// and distributions income with an unknown spot price.
+func ReadBinanceTransactions(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("UTC_Time", "Operation", "Coin", "Change")
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	// The changes of each trade, by time and then by asset
+	trades := make(map[time.Time]map[string]decimal.Decimal)
+	fees := make(map[time.Time]map[string]decimal.Decimal)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		timestamp, err := parseTimestamp(field(record, h.index("UTC_Time")))
+		if err != nil {
+			return transactions, err
+		}
+		asset := strings.ToUpper(field(record, h.index("Coin")))
+		change, err := amountField(h, record, "Change")
+		if err != nil {
+			return transactions, err
+		}
+
+		name := field(record, h.index("Operation"))
+		operation, ok := binanceOperations[strings.ToLower(name)]
+		if !ok {
+			log.Warnf("Skipping unknown Binance operation '%s' on %s", name, field(record, h.index("UTC_Time")))
+			continue
+		}
+
+		t := &a.Transaction{
+			Timestamp: timestamp,
+			Asset:     asset,
+			Quantity:  change.Abs(),
+		}
+
+		switch operation {
+		case binanceTradeLeg, binanceFee:
+			changes := trades
+			if operation == binanceFee {
+				changes = fees
+			}
+			if _, ok := changes[timestamp]; !ok {
+				changes[timestamp] = make(map[string]decimal.Decimal)
+			}
+			changes[timestamp][asset] = changes[timestamp][asset].Add(change)
+			continue
+		case binanceDeposit:
+			t.Action = a.TRANSFER_IN
+		case binanceWithdrawal:
+			t.Action = a.TRANSFER_OUT
+		case binanceIncome:
+			t.Action = a.INCOME
+		default:
+			continue
+		}
+
+		if fiatCurrencies[asset] || t.Quantity.IsZero() {
+			continue
+		}
+		transactions = append(transactions, t)
+	}
+
+	times := make([]time.Time, 0, len(trades))
+	for timestamp := range trades {
+		times = append(times, timestamp)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	for _, timestamp := range times {
+		var spent, received, fee leg
+		for asset, change := range trades[timestamp] {
+			side := leg{asset, change.Abs()}
+			if change.IsNegative() {
+				if spent.asset != "" {
+					return transactions, fmt.Errorf("Binance trades on %s spend both %s and %s", timestamp, spent.asset, asset)
+				}
+				spent = side
+			} else if change.IsPositive() {
+				if received.asset != "" {
+					return transactions, fmt.Errorf("Binance trades on %s receive both %s and %s", timestamp, received.asset, asset)
+				}
+				received = side
+			}
+		}
+		if spent.asset == "" || received.asset == "" {
+			return transactions, fmt.Errorf("Binance trade on %s does not spend one asset for another", timestamp)
+		}
+
+		for asset, change := range fees[timestamp] {
+			if fee.asset != "" {
+				return transactions, fmt.Errorf("Binance trades on %s pay fees in both %s and %s", timestamp, fee.asset, asset)
+			}
+			fee = leg{asset, change.Abs()}
+		}
+
+		if t := tradeTransaction(timestamp, spent, received, fee); t != nil {
+			transactions = append(transactions, t)
+		}
+	}
+
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.Before(transactions[j].Timestamp)
+	})
+	return transactions, nil
+}
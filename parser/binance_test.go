@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/sklarsa/crypto-taxes/prices"
+	"github.com/stretchr/testify/assert"
+)
+
+const binanceTradesFile = `Date(UTC),Pair,Side,Price,Executed,Amount,Fee
+2021-01-04 12:00:00,BTCUSD,SELL,40000,0.1BTC,4000USD,4USD
+2021-01-03 12:00:00,ETHBTC,BUY,0.03,2ETH,0.06BTC,0.002ETH
+2021-01-02 12:00:00,BTCUSD,BUY,30000,0.5BTC,15000USD,0.0375BNB
+`
+
+func TestReadBinanceTrades(t *testing.T) {
+	transactions, err := ReadBinanceTrades(strings.NewReader(binanceTradesFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 3, len(transactions)) {
+		return
+	}
+
+	// A fee paid in BNB is recorded separately
+	buy := transactions[0]
+	assert.Equal(t, a.BUY, buy.Action)
+	assert.Equal(t, "BTC", buy.Asset)
+	assert.Equal(t, "0.5", buy.Quantity.String())
+	assert.Equal(t, "30000", buy.Spot.String())
+	assert.True(t, buy.Fee.IsZero())
+	assert.Equal(t, "USD", buy.Currency)
+	assert.Equal(t, "BNB", buy.FeeAsset)
+	assert.Equal(t, "0.0375", buy.FeeQuantity.String())
+
+	// A fee paid in the asset received comes out of it
+	convert := transactions[1]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "BTC", convert.Asset)
+	assert.Equal(t, "0.06", convert.Quantity.String())
+	assert.Equal(t, "ETH", convert.ToAsset)
+	assert.Equal(t, "1.998", convert.ToQuantity.String())
+	assert.Equal(t, "", convert.FeeAsset)
+
+	sell := transactions[2]
+	assert.Equal(t, a.SELL, sell.Action)
+	assert.Equal(t, "0.1", sell.Quantity.String())
+	assert.Equal(t, "40000", sell.Spot.String())
+	assert.Equal(t, "4", sell.Fee.String())
+}
+
+func TestBinanceTradesAccount(t *testing.T) {
+	transactions, err := ReadBinanceTrades(strings.NewReader(binanceTradesFile))
+	if !assert.Nil(t, err) {
+		return
+	}
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	bnb := &a.Transaction{Timestamp: t0, Action: a.BUY, Asset: "BNB", Quantity: decimal.NewFromInt(1), Spot: decimal.NewFromInt(40), Currency: "USD"}
+
+	// Without a price history the BNB fee cannot be valued
+	account := a.NewAccount()
+	assert.Nil(t, account.ProcessTransaction(bnb, nil, nil))
+	assert.Equal(t, []string{"BNB"}, transactions[0].Unpriced())
+	err = account.ProcessTransaction(transactions[0], make(chan *a.Sale, 1), nil)
+	assert.IsType(t, &a.MissingPriceErr{}, err)
+
+	history := prices.NewFiles()
+	history.Add("BNB", "USD", prices.History{{Time: t0.AddDate(0, 0, 1), Price: decimal.NewFromInt(40)}})
+	history.Add("BTC", "USD", prices.History{{Time: t0.AddDate(0, 0, 2), Price: decimal.NewFromInt(32000)}})
+	account = a.NewAccount()
+	account.Prices = history
+	assert.Nil(t, account.ProcessTransaction(bnb, nil, nil))
+
+	sales := make(chan *a.Sale, 10)
+	for _, tr := range transactions {
+		assert.Nil(t, account.ProcessTransaction(tr, sales, nil), tr.Action.String())
+	}
+	close(sales)
+
+	// The fee is a disposal of BNB, added to the cost of the BTC bought
+	fee := <-sales
+	assert.Equal(t, "BNB", fee.Asset)
+	assert.Equal(t, "0.0375", fee.Quantity.String())
+	assert.Equal(t, "0.9625", account.Holdings["BNB"].Quantity().String())
+	assert.Equal(t, "1.998", account.Holdings["ETH"].Quantity().String())
+	assert.Equal(t, "0.34", account.Holdings["BTC"].Quantity().String())
+}
+
+const binanceTransactionsFile = `User_ID,UTC_Time,Account,Operation,Coin,Change,Remark
+1,2021-01-01 09:00:00,Spot,Deposit,BTC,0.5,
+1,2021-01-02 12:00:00,Spot,Transaction Spend,BTC,-0.03,
+1,2021-01-02 12:00:00,Spot,Transaction Buy,ETH,0.6,
+1,2021-01-02 12:00:00,Spot,Transaction Buy,ETH,0.4,
+1,2021-01-02 12:00:00,Spot,Transaction Fee,BNB,-0.01,
+1,2021-01-03 00:00:00,Spot,Simple Earn Flexible Subscription,ETH,-1,
+1,2021-01-04 00:00:00,Earn,Simple Earn Flexible Interest,ETH,0.001,
+1,2021-01-05 10:00:00,Spot,Withdraw,BTC,-0.4,
+`
+
+func TestReadBinanceTransactions(t *testing.T) {
+	transactions, err := ReadBinanceTransactions(strings.NewReader(binanceTransactionsFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 4, len(transactions)) {
+		return
+	}
+
+	assert.Equal(t, a.TRANSFER_IN, transactions[0].Action)
+	assert.Equal(t, "0.5", transactions[0].Quantity.String())
+
+	// The fills of a trade are joined
+	convert := transactions[1]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "BTC", convert.Asset)
+	assert.Equal(t, "0.03", convert.Quantity.String())
+	assert.Equal(t, "ETH", convert.ToAsset)
+	assert.Equal(t, "1", convert.ToQuantity.String())
+	assert.Equal(t, "BNB", convert.FeeAsset)
+	assert.Equal(t, "0.01", convert.FeeQuantity.String())
+
+	assert.Equal(t, a.INCOME, transactions[2].Action)
+	assert.Equal(t, "ETH", transactions[2].Asset)
+	assert.Equal(t, "0.001", transactions[2].Quantity.String())
+
+	assert.Equal(t, a.TRANSFER_OUT, transactions[3].Action)
+	assert.Equal(t, "0.4", transactions[3].Quantity.String())
+}
+
+func TestBinanceAmount(t *testing.T) {
+	amount, asset, err := binanceAmount("12.51INCH", "1INCH", "USDT")
+	assert.Nil(t, err)
+	assert.Equal(t, "12.5", amount.String())
+	assert.Equal(t, "1INCH", asset)
+
+	amount, asset, err = binanceAmount("0.00075BNB")
+	assert.Nil(t, err)
+	assert.Equal(t, "0.00075", amount.String())
+	assert.Equal(t, "BNB", asset)
+}
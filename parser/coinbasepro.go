@@ -0,0 +1,121 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+var coinbaseProHeaders = []string{"trade id", "product", "side", "created at", "size", "price", "fee", "total"}
+
+// ReadCoinbaseProFills reads a Coinbase Pro or Advanced Trade fills report
+// from r.  Trades quoted in fiat become BUYs and SELLs, and trades quoted in
+// another crypto (e.g. ETH-BTC) become CONVERTs with an unknown spot price.
+func ReadCoinbaseProFills(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has(coinbaseProHeaders...)
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		transaction, err := coinbaseProTransaction(h, record)
+		if err != nil {
+			return transactions, err
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
+
+func coinbaseProTransaction(h header, record []string) (*a.Transaction, error) {
+	id := field(record, h.index("trade id"))
+
+	product := strings.SplitN(field(record, h.index("product")), "-", 2)
+	if len(product) != 2 {
+		return nil, fmt.Errorf("Invalid product %s in trade %s", field(record, h.index("product")), id)
+	}
+	base, quote := strings.ToUpper(product[0]), strings.ToUpper(product[1])
+
+	timestamp, err := parseTimestamp(field(record, h.index("created at")))
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := amountField(h, record, "size")
+	if err != nil {
+		return nil, err
+	}
+	price, err := amountField(h, record, "price")
+	if err != nil {
+		return nil, err
+	}
+	fee, err := amountField(h, record, "fee")
+	if err != nil {
+		return nil, err
+	}
+	total, err := amountField(h, record, "total")
+	if err != nil {
+		return nil, err
+	}
+
+	var action a.Action
+	switch strings.ToUpper(field(record, h.index("side"))) {
+	case "BUY":
+		action = a.BUY
+	case "SELL":
+		action = a.SELL
+	default:
+		return nil, fmt.Errorf("Invalid side %s in trade %s", field(record, h.index("side")), id)
+	}
+
+	transaction := &a.Transaction{
+		ID:        id,
+		Timestamp: timestamp,
+		Action:    action,
+		Asset:     base,
+		Quantity:  size.Abs(),
+		Spot:      price,
+		Fee:       fee.Abs(),
+		Currency:  quote,
+	}
+	if fiatCurrencies[quote] {
+		return transaction, nil
+	}
+
+	// A crypto quoted trade disposes of one asset to acquire the other.  The
+	// total, net of the fee charged in the quote asset, is the quote amount
+	// exchanged.
+	transaction.Action = a.CONVERT
+	transaction.Spot = decimal.Zero
+	transaction.Fee = decimal.Zero
+	transaction.Currency = ""
+	if action == a.BUY {
+		transaction.Asset, transaction.Quantity = quote, total.Abs()
+		transaction.ToAsset, transaction.ToQuantity = base, size.Abs()
+	} else {
+		transaction.ToAsset, transaction.ToQuantity = quote, total.Abs()
+	}
+	return transaction, nil
+}
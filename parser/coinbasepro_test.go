@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/sklarsa/crypto-taxes/prices"
+	"github.com/stretchr/testify/assert"
+)
+
+const coinbaseProFile = `portfolio,trade id,product,side,created at,size,size unit,price,fee,total,price/fee/total unit
+default,1001,BTC-USD,BUY,2021-01-01T12:00:00.123Z,0.5,BTC,30000.00,75.00,-15075.00,USD
+default,1002,ETH-BTC,BUY,2021-01-02T12:00:00.000Z,2,ETH,0.03,0.0003,-0.0603,BTC
+default,1003,ETH-BTC,SELL,2021-01-03T12:00:00.000Z,1,ETH,0.04,0.0002,0.0398,BTC
+default,1004,BTC-EUR,SELL,2021-01-04T12:00:00.000Z,0.1,BTC,25000.00,12.50,2487.50,EUR
+`
+
+func TestReadCoinbaseProFills(t *testing.T) {
+	transactions, err := ReadCoinbaseProFills(strings.NewReader(coinbaseProFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 4, len(transactions)) {
+		return
+	}
+
+	buy := transactions[0]
+	assert.Equal(t, "1001", buy.ID)
+	assert.Equal(t, a.BUY, buy.Action)
+	assert.Equal(t, "BTC", buy.Asset)
+	assert.Equal(t, "0.5", buy.Quantity.String())
+	assert.Equal(t, "30000", buy.Spot.String())
+	assert.Equal(t, "75", buy.Fee.String())
+	assert.Equal(t, "USD", buy.Currency)
+
+	// Buying ETH with BTC disposes of the BTC, including the fee
+	convert := transactions[1]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "BTC", convert.Asset)
+	assert.Equal(t, "0.0603", convert.Quantity.String())
+	assert.Equal(t, "ETH", convert.ToAsset)
+	assert.Equal(t, "2", convert.ToQuantity.String())
+	assert.True(t, convert.Spot.IsZero())
+
+	// Selling ETH for BTC receives the BTC, net of the fee
+	convert = transactions[2]
+	assert.Equal(t, "ETH", convert.Asset)
+	assert.Equal(t, "1", convert.Quantity.String())
+	assert.Equal(t, "BTC", convert.ToAsset)
+	assert.Equal(t, "0.0398", convert.ToQuantity.String())
+
+	sell := transactions[3]
+	assert.Equal(t, a.SELL, sell.Action)
+	assert.Equal(t, "EUR", sell.Currency)
+}
+
+func TestCoinbaseProFillsAccount(t *testing.T) {
+	transactions, err := ReadCoinbaseProFills(strings.NewReader(coinbaseProFile))
+	if !assert.Nil(t, err) {
+		return
+	}
+	// The fills in USD, leaving out the sale in EUR
+	transactions = transactions[:3]
+
+	// A fill quoted in another crypto has no price without a price history
+	account := a.NewAccount()
+	assert.Nil(t, account.ProcessTransaction(transactions[0], nil, nil))
+	assert.Equal(t, []string{"BTC"}, transactions[1].Unpriced())
+	err = account.ProcessTransaction(transactions[1], make(chan *a.Sale, 1), nil)
+	assert.IsType(t, &a.MissingPriceErr{}, err)
+	assert.Equal(t, "0.5", account.Holdings["BTC"].Quantity().String())
+
+	t0 := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	history := prices.NewFiles()
+	history.Add("BTC", "USD", prices.History{{Time: t0.AddDate(0, 0, 1), Price: decimal.NewFromInt(32000)}})
+	history.Add("ETH", "USD", prices.History{{Time: t0.AddDate(0, 0, 2), Price: decimal.NewFromInt(1100)}})
+	account = a.NewAccount()
+	account.Prices = history
+
+	sales := make(chan *a.Sale, 10)
+	for _, tr := range transactions {
+		assert.Nil(t, account.ProcessTransaction(tr, sales, nil), tr.Action.String())
+	}
+	close(sales)
+
+	// The BTC spent is sold at its market value, which is the cost of the ETH
+	btc := <-sales
+	assert.Equal(t, "BTC", btc.Asset)
+	assert.Equal(t, "1929.6", btc.Proceeds.String())
+	eth := <-sales
+	assert.Equal(t, "ETH", eth.Asset)
+	assert.Equal(t, "964.8", eth.FifoCost.String())
+	assert.Equal(t, "1100", eth.Proceeds.String())
+}
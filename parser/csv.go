@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// header maps the normalized names of csv columns to their positions
+type header map[string]int
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+}
+
+func newHeader(record []string) header {
+	h := make(header)
+	for i, name := range record {
+		if _, ok := h[normalize(name)]; !ok {
+			h[normalize(name)] = i
+		}
+	}
+	return h
+}
+
+// index returns the position of the first column found out of names, or -1
+func (h header) index(names ...string) int {
+	for _, name := range names {
+		if i, ok := h[normalize(name)]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// prefix returns the word before the name of the first column ending with
+// name, e.g. "USD" for a column named "USD Fees" and name "Fees"
+func (h header) prefix(name string) string {
+	suffix := " " + normalize(name)
+	for column := range h {
+		if strings.HasSuffix(column, suffix) {
+			return strings.ToUpper(strings.TrimSuffix(column, suffix))
+		}
+	}
+	return ""
+}
+
+// has returns true if the header contains every one of names
+func (h header) has(names ...string) bool {
+	for _, name := range names {
+		if h.index(name) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// field returns the trimmed value of column i, or "" when the column is missing
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// blank returns true if every field of the record is empty
+func blank(record []string) bool {
+	for i := range record {
+		if field(record, i) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// NoHeaderErr is an error for a file without the header row of the format
+// being read
+type NoHeaderErr struct{}
+
+func (m *NoHeaderErr) Error() string {
+	return "No header row found"
+}
+
+// findHeader reads records from r until one is found that matches, skipping
+// any preamble.  It returns the header and a reader positioned after it.
+func findHeader(r io.Reader, matches func(header) bool) (header, *csv.Reader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil, reader, &NoHeaderErr{}
+		}
+		if err != nil {
+			return nil, reader, err
+		}
+
+		h := newHeader(record)
+		if matches(h) {
+			return h, reader, nil
+		}
+	}
+}
+
+// currencyCode matches a currency code before or after an amount, e.g.
+// "EUR 5.00", "EUR5.00" or "1 DOGE"
+var currencyCode = regexp.MustCompile(`^[A-Za-z]{3,5}\s*|\s*[A-Za-z]{3,5}$`)
+
+// parseAmount parses a number, ignoring currency symbols and codes and
+// thousands separators.  Amounts in parentheses are negative.  An empty
+// value is zero.
+func parseAmount(value string) (decimal.Decimal, error) {
+	value = currencyCode.ReplaceAllString(strings.TrimSpace(value), "")
+
+	negative := strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")")
+	var digits strings.Builder
+	previous := ' '
+	for _, r := range value {
+		// An exponent directly follows a digit, any other letter is part
+		// of a currency
+		if unicode.IsDigit(r) || strings.ContainsRune(".-", r) || (strings.ContainsRune("eE", r) && unicode.IsDigit(previous)) {
+			digits.WriteRune(r)
+		}
+		previous = r
+	}
+	value = digits.String()
+	if value == "" {
+		return decimal.Zero, nil
+	}
+
+	amount, err := decimal.NewFromString(value)
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, err
+}
+
+// amountField parses the amount in the named column of record
+func amountField(h header, record []string, name string) (decimal.Decimal, error) {
+	value := field(record, h.index(name))
+	amount, err := parseAmount(value)
+	if err != nil {
+		return amount, fmt.Errorf("Invalid %s %s", name, value)
+	}
+	return amount, nil
+}
+
+// timestampLayouts are the timestamp formats found in exchange exports
+var timestampLayouts = []string{
+	"2006-01-02T15:04:05Z",
+	time.RFC3339,
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// parseTimestamp parses a timestamp in any of the timestampLayouts, as UTC
+// when the timestamp has no zone
+func parseTimestamp(value string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, strings.TrimSpace(value))
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %s", value)
+}
@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// etherscanValueColumn matches the value column of a normal or internal
+// transactions export, e.g. "Value_IN(ETH)", giving the native asset of the
+// chain, so that exports from BscScan and the like can be read too
+var etherscanValueColumn = regexp.MustCompile(`^value_in\((\w+)\)$`)
+
+// Etherscan reads the normal transactions, ERC-20 token transfers and
+// internal transactions csv exports of Etherscan.  Addresses are the
+// addresses owned, and when empty the owned address is the one found in
+// every row of the export, which is the address it was exported for.
+type Etherscan struct {
+	Addresses []string
+}
+
+// ReadEtherscan reads an Etherscan export of the address it was exported
+// for from r
+func ReadEtherscan(r io.Reader) ([]*a.Transaction, error) {
+	return Etherscan{}.Read(r)
+}
+
+// etherscanRow is a transfer of value in an Etherscan export
+type etherscanRow struct {
+	hash      string
+	timestamp time.Time
+	from      string
+	to        string
+	asset     string
+	quantity  decimal.Decimal
+	spot      decimal.Decimal
+	price     decimal.Decimal
+	fee       decimal.Decimal
+	failed    bool
+}
+
+// Read reads an Etherscan export from r.  Value sent from an owned address
+// to another address is a TRANSFER_OUT, and value received by an owned
+// address a TRANSFER_IN, tagged with the owned address as their Wallet.
+// Moves between owned addresses are not transactions.  The gas paid by an
+// owned address is a SELL of the native asset, including for failed
+// transactions.  Transactions are priced in USD when the export has
+// historical prices.  It has the signature of a Reader.
+func (e Etherscan) Read(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("Txhash", "From") && h.index("To", "TxTo") >= 0
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	native := ""
+	for name := range h {
+		if match := etherscanValueColumn.FindStringSubmatch(name); match != nil {
+			native = strings.ToUpper(match[1])
+		}
+	}
+	if native == "" && !h.has("TokenSymbol") {
+		return transactions, fmt.Errorf("Missing heading 'Value_IN' or 'TokenSymbol'")
+	}
+
+	rows := make([]etherscanRow, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		row, err := etherscanRecord(h, record, native)
+		if err != nil {
+			return transactions, err
+		}
+		rows = append(rows, row)
+	}
+
+	owned, err := e.owned(rows)
+	if err != nil {
+		return transactions, err
+	}
+
+	for _, row := range rows {
+		t := &a.Transaction{
+			ID:        row.hash,
+			Timestamp: row.timestamp,
+			Asset:     row.asset,
+			Quantity:  row.quantity,
+			Spot:      row.spot,
+		}
+		if !row.spot.IsZero() {
+			t.Currency = "USD"
+		}
+
+		switch {
+		case row.failed || row.quantity.IsZero() || (owned[row.from] && owned[row.to]):
+			t = nil
+		case owned[row.from]:
+			t.Action, t.Wallet = a.TRANSFER_OUT, row.from
+		case owned[row.to]:
+			t.Action, t.Wallet = a.TRANSFER_IN, row.to
+		default:
+			t = nil
+		}
+		if t != nil {
+			transactions = append(transactions, t)
+		}
+
+		if owned[row.from] && row.fee.IsPositive() {
+			gas := &a.Transaction{
+				ID:        row.hash + "-gas",
+				Timestamp: row.timestamp,
+				Action:    a.SELL,
+				Wallet:    row.from,
+				Asset:     native,
+				Quantity:  row.fee,
+				Spot:      row.price,
+			}
+			if !row.price.IsZero() {
+				gas.Currency = "USD"
+			}
+			transactions = append(transactions, gas)
+		}
+	}
+
+	return transactions, nil
+}
+
+// owned returns the set of owned addresses, finding the address the export
+// is for when no Addresses are given
+func (e Etherscan) owned(rows []etherscanRow) (map[string]bool, error) {
+	owned := make(map[string]bool)
+	for _, address := range e.Addresses {
+		owned[strings.ToLower(strings.TrimSpace(address))] = true
+	}
+	if len(owned) > 0 || len(rows) == 0 {
+		return owned, nil
+	}
+
+	candidates := []string{rows[0].from, rows[0].to}
+	for _, candidate := range candidates {
+		if owned[candidate] {
+			continue
+		}
+		found := candidate != ""
+		for _, row := range rows {
+			if row.from != candidate && row.to != candidate {
+				found = false
+				break
+			}
+		}
+		if found {
+			if len(owned) > 0 {
+				return owned, fmt.Errorf("Cannot tell whether %s or %s is the owned address", rows[0].from, rows[0].to)
+			}
+			owned[candidate] = true
+		}
+	}
+	if len(owned) == 0 {
+		return owned, fmt.Errorf("No address is in every transaction, the owned addresses must be given")
+	}
+	return owned, nil
+}
+
+// etherscanRecord reads a row of a normal, ERC-20 or internal transactions
+// export.  The price is that of the native asset, which gas is paid in.
+func etherscanRecord(h header, record []string, native string) (etherscanRow, error) {
+	row := etherscanRow{
+		hash: field(record, h.index("Txhash")),
+		from: strings.ToLower(field(record, h.index("From"))),
+		to:   strings.ToLower(field(record, h.index("To", "TxTo"))),
+	}
+
+	var err error
+	if unix := field(record, h.index("UnixTimestamp")); unix != "" {
+		seconds, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			return row, fmt.Errorf("Invalid time %s", unix)
+		}
+		row.timestamp = time.Unix(seconds, 0).UTC()
+	} else if row.timestamp, err = parseTimestamp(field(record, h.index("DateTime (UTC)", "DateTime"))); err != nil {
+		return row, err
+	}
+
+	status := strings.ToLower(field(record, h.index("Status")))
+	row.failed = strings.Contains(status, "error") || field(record, h.index("ErrCode")) != ""
+
+	if symbol := h.index("TokenSymbol"); symbol >= 0 {
+		row.asset = strings.ToUpper(field(record, symbol))
+		name := "TokenValue"
+		if !h.has(name) {
+			name = "Value"
+		}
+		if row.quantity, err = amountField(h, record, name); err != nil {
+			return row, err
+		}
+		total, err := amountField(h, record, "USDValueDayOfTx")
+		if err != nil {
+			return row, err
+		}
+		if !row.quantity.IsZero() {
+			row.spot = total.Div(row.quantity)
+		}
+		return row, nil
+	}
+
+	row.asset = native
+	in, err := amountField(h, record, fmt.Sprintf("Value_IN(%s)", native))
+	if err != nil {
+		return row, err
+	}
+	out, err := amountField(h, record, fmt.Sprintf("Value_OUT(%s)", native))
+	if err != nil {
+		return row, err
+	}
+	row.quantity = in.Add(out)
+	if row.fee, err = amountField(h, record, fmt.Sprintf("TxnFee(%s)", native)); err != nil {
+		return row, err
+	}
+
+	price := field(record, h.index(fmt.Sprintf("Historical $Price/%s", native)))
+	if row.price, err = parseAmount(price); err != nil {
+		return row, fmt.Errorf("Invalid price %s", price)
+	}
+	row.spot = row.price
+	return row, nil
+}
@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+const etherscanNormalFile = `"Txhash","Blockno","UnixTimestamp","DateTime (UTC)","From","To","ContractAddress","Value_IN(ETH)","Value_OUT(ETH)","CurrentValue @ $3000/Eth","TxnFee(ETH)","TxnFee(USD)","Historical $Price/Eth","Status","ErrCode","Method"
+"0x1","100","1609502400","2021-01-01 12:00:00","0xexchange","0xMine","","2","0","6000","0.001","1","1000","","","Transfer"
+"0x2","101","1609588800","2021-01-02 12:00:00","0xmine","0xfriend","","0.5","0","1500","0.002","2","1100","","","Transfer"
+"0x3","102","1609675200","2021-01-03 12:00:00","0xmine","0xcontract","","0","0","0","0.003","3","1200","Error(0)","Out of gas","Swap"
+"0x4","103","1609761600","2021-01-04 12:00:00","0xmine","0xcold","","1","0","3000","0.001","1","1300","","","Transfer"
+`
+
+const etherscanTokenFile = `"Txhash","UnixTimestamp","DateTime (UTC)","From","To","TokenValue","USDValueDayOfTx","ContractAddress","TokenName","TokenSymbol"
+"0x5","1609848000","2021-01-05 12:00:00","0xmine","0xexchange","1,000","$1,000.00","0xusdc","USD Coin","USDC"
+"0x7","1609934400","2021-01-06 12:00:00","0xairdrop","0xmine","50","","0xuni","Uniswap","UNI"
+`
+
+const etherscanInternalFile = `"Txhash","Blockno","UnixTimestamp","DateTime (UTC)","ParentTxFrom","ParentTxTo","ParentTxETH_Value","From","TxTo","ContractAddress","Value_IN(ETH)","Value_OUT(ETH)","CurrentValue @ $3000/Eth","Historical $Price/Eth","Status","ErrCode","Type"
+"0x6","105","1609934400","2021-01-06 12:00:00","0xmine","0xrouter","0","0xrouter","0xmine","","0.25","0","750","1400","0","","call"
+`
+
+func TestReadEtherscan(t *testing.T) {
+	e := Etherscan{Addresses: []string{"0xMine", "0xcold"}}
+	transactions, err := e.Read(strings.NewReader(etherscanNormalFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 5, len(transactions)) {
+		return
+	}
+
+	deposit := transactions[0]
+	assert.Equal(t, "0x1", deposit.ID)
+	assert.Equal(t, a.TRANSFER_IN, deposit.Action)
+	assert.Equal(t, "0xmine", deposit.Wallet)
+	assert.Equal(t, "ETH", deposit.Asset)
+	assert.Equal(t, "2", deposit.Quantity.String())
+	assert.Equal(t, "1000", deposit.Spot.String())
+	assert.Equal(t, "2021-01-01T12:00:00Z", deposit.Timestamp.Format("2006-01-02T15:04:05Z07:00"))
+
+	sent := transactions[1]
+	assert.Equal(t, a.TRANSFER_OUT, sent.Action)
+	assert.Equal(t, "0.5", sent.Quantity.String())
+	gas := transactions[2]
+	assert.Equal(t, "0x2-gas", gas.ID)
+	assert.Equal(t, a.SELL, gas.Action)
+	assert.Equal(t, "0xmine", gas.Wallet)
+	assert.Equal(t, "0.002", gas.Quantity.String())
+	assert.Equal(t, "1100", gas.Spot.String())
+	assert.Equal(t, "USD", gas.Currency)
+
+	// A failed transaction still pays for its gas
+	assert.Equal(t, "0x3-gas", transactions[3].ID)
+	assert.Equal(t, "0.003", transactions[3].Quantity.String())
+
+	// A move to another owned address only pays for gas
+	assert.Equal(t, "0x4-gas", transactions[4].ID)
+}
+
+func TestReadEtherscanTokensAndInternal(t *testing.T) {
+	// The owned address is the one in every row
+	transactions, err := ReadEtherscan(strings.NewReader(etherscanTokenFile))
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(transactions)) {
+		assert.Equal(t, a.TRANSFER_OUT, transactions[0].Action)
+		assert.Equal(t, "USDC", transactions[0].Asset)
+		assert.Equal(t, "1000", transactions[0].Quantity.String())
+		assert.Equal(t, "1", transactions[0].Spot.String())
+		assert.Equal(t, a.TRANSFER_IN, transactions[1].Action)
+		assert.Equal(t, "0xmine", transactions[1].Wallet)
+		assert.True(t, transactions[1].Spot.IsZero())
+	}
+
+	// With a single row, either address could be the owned one
+	_, err = ReadEtherscan(strings.NewReader(etherscanInternalFile))
+	assert.Error(t, err)
+
+	transactions, err = Etherscan{Addresses: []string{"0xmine"}}.Read(strings.NewReader(etherscanInternalFile))
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(transactions)) {
+		assert.Equal(t, a.TRANSFER_IN, transactions[0].Action)
+		assert.Equal(t, "0xmine", transactions[0].Wallet)
+		assert.Equal(t, "0.25", transactions[0].Quantity.String())
+	}
+}
@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// geminiAmountColumn and geminiFeeColumn match the per-currency columns of a
+// Gemini export, e.g. "BTC Amount BTC" and "Fee (BTC) BTC"
+var (
+	geminiAmountColumn = regexp.MustCompile(`^(\w+) amount \w+$`)
+	geminiFeeColumn    = regexp.MustCompile(`^fee \((\w+)\) \w+$`)
+)
+
+// geminiColumns are the positions of the amount and fee columns of each
+// currency
+type geminiColumns struct {
+	amounts map[string]int
+	fees    map[string]int
+}
+
+func newGeminiColumns(h header) geminiColumns {
+	cols := geminiColumns{
+		amounts: make(map[string]int),
+		fees:    make(map[string]int),
+	}
+	for name, i := range h {
+		if match := geminiAmountColumn.FindStringSubmatch(name); match != nil {
+			cols.amounts[strings.ToUpper(match[1])] = i
+		} else if match := geminiFeeColumn.FindStringSubmatch(name); match != nil {
+			cols.fees[strings.ToUpper(match[1])] = i
+		}
+	}
+	return cols
+}
+
+// geminiAmount parses an amount such as "(0.5 BTC)" or "$1,000.00" from a
+// column of currency
+func geminiAmount(value, currency string) (decimal.Decimal, error) {
+	amount, err := parseAmount(strings.Replace(strings.ToUpper(value), currency, "", 1))
+	if err != nil {
+		return amount, fmt.Errorf("Invalid %s amount %s", currency, value)
+	}
+	return amount, nil
+}
+
+// changes returns the non-zero amounts of the given columns, by currency
+func (cols geminiColumns) changes(record []string, columns map[string]int) (map[string]decimal.Decimal, error) {
+	changes := make(map[string]decimal.Decimal)
+	for currency, i := range columns {
+		amount, err := geminiAmount(field(record, i), currency)
+		if err != nil {
+			return changes, err
+		}
+		if !amount.IsZero() {
+			changes[currency] = amount
+		}
+	}
+	return changes, nil
+}
+
+// ReadGemini reads a Gemini transaction history export, saved as csv, from
+// r.  Gemini has a column per currency for the change in balance ("BTC
+// Amount BTC") and the fee ("Fee (BTC) BTC"), so the currencies of each row
+// are found from the columns it fills in.  Buys and sells become BUYs and
+// SELLs, or CONVERTs for crypto pairs.  Credits and debits of crypto become
+// transfers, withdrawal fees a disposal of the fee, and Earn interest
+// income.
+func ReadGemini(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("Date", "Type", "Symbol") && len(newGeminiColumns(h).amounts) > 0
+	})
+	if err != nil {
+		return transactions, err
+	}
+	cols := newGeminiColumns(h)
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		// The export ends with a row of totals without a date
+		if blank(record) || field(record, h.index("Date")) == "" {
+			continue
+		}
+
+		date := field(record, h.index("Date"))
+		if clock := field(record, h.index("Time (UTC)", "Time")); clock != "" {
+			date += " " + clock
+		}
+		timestamp, err := parseTimestamp(date)
+		if err != nil {
+			return transactions, err
+		}
+
+		amounts, err := cols.changes(record, cols.amounts)
+		if err != nil {
+			return transactions, err
+		}
+		fees, err := cols.changes(record, cols.fees)
+		if err != nil {
+			return transactions, err
+		}
+
+		id := field(record, h.index("Trade ID"))
+		if id == "" {
+			id = field(record, h.index("Tx Hash"))
+		}
+
+		kind := strings.ToLower(field(record, h.index("Type")))
+		specification := strings.ToLower(field(record, h.index("Specification")))
+		switch {
+		case kind == "buy" || kind == "sell":
+			t, err := geminiTrade(timestamp, amounts, fees)
+			if err != nil {
+				return transactions, err
+			}
+			if t != nil {
+				t.ID = id
+				transactions = append(transactions, t)
+			}
+
+		case strings.Contains(kind, "interest") || strings.Contains(specification, "interest"):
+			for currency, amount := range amounts {
+				if fiatCurrencies[currency] || amount.IsNegative() {
+					continue
+				}
+				transactions = append(transactions, &a.Transaction{
+					ID:        id,
+					Timestamp: timestamp,
+					Action:    a.INCOME,
+					Asset:     currency,
+					Quantity:  amount,
+				})
+			}
+
+		case strings.Contains(specification, "earn"):
+			// Moves into and out of Gemini Earn are not transactions
+			continue
+
+		case kind == "credit" || kind == "debit":
+			for currency, amount := range amounts {
+				if fiatCurrencies[currency] {
+					continue
+				}
+				t := &a.Transaction{
+					ID:        id,
+					Timestamp: timestamp,
+					Action:    a.TRANSFER_IN,
+					Asset:     currency,
+					Quantity:  amount.Abs(),
+				}
+				if amount.IsNegative() {
+					t.Action = a.TRANSFER_OUT
+				}
+				transactions = append(transactions, t)
+			}
+			// A fee on a withdrawal is spent rather than transferred
+			for currency, fee := range fees {
+				if fiatCurrencies[currency] {
+					continue
+				}
+				transactions = append(transactions, &a.Transaction{
+					ID:        id + "-fee",
+					Timestamp: timestamp,
+					Action:    a.SELL,
+					Asset:     currency,
+					Quantity:  fee.Abs(),
+				})
+			}
+
+		default:
+			log.Warnf("Skipping Gemini %s on %s", field(record, h.index("Type")), date)
+		}
+	}
+
+	return transactions, nil
+}
+
+// geminiTrade joins the amounts spent and received by a Gemini buy or sell
+func geminiTrade(timestamp time.Time, amounts, fees map[string]decimal.Decimal) (*a.Transaction, error) {
+	var spent, received, fee leg
+	for currency, amount := range amounts {
+		if amount.IsNegative() {
+			spent = leg{currency, amount.Abs()}
+		} else {
+			received = leg{currency, amount}
+		}
+	}
+	if spent.asset == "" || received.asset == "" || len(amounts) != 2 {
+		return nil, fmt.Errorf("Gemini trade on %s does not spend one asset for another", timestamp)
+	}
+
+	for currency, amount := range fees {
+		if fee.asset != "" {
+			return nil, fmt.Errorf("Gemini trade on %s pays fees in both %s and %s", timestamp, fee.asset, currency)
+		}
+		fee = leg{currency, amount.Abs()}
+	}
+
+	return tradeTransaction(timestamp, spent, received, fee), nil
+}
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+const geminiFile = `Date,Time (UTC),Type,Symbol,Specification,USD Amount USD,Fee (USD) USD,USD Balance USD,BTC Amount BTC,Fee (BTC) BTC,BTC Balance BTC,ETH Amount ETH,Fee (ETH) ETH,ETH Balance ETH,Trade ID,Tx Hash
+2021-01-01,09:00:00.000,Credit,USD,ACH,"$20,000.00 ",,"$20,000.00 ",,,,,,,,
+2021-01-02,12:00:00.123,Buy,BTCUSD,Exchange,"($15,000.00)",($22.50),"$4,977.50 ",0.5 BTC,,0.5 BTC,,,,1001,
+2021-01-03,12:00:00.000,Buy,ETHBTC,Exchange,,,,(0.03 BTC),(0.00003 BTC),0.46997 BTC,1.0 ETH,,1.0 ETH,1002,
+2021-01-04,00:00:00.000,Credit,ETH,Gemini Earn Interest,,,,,,,0.001 ETH,,1.001 ETH,,
+2021-01-05,10:00:00.000,Debit,BTC,Withdrawal (BTC),,,,(0.2 BTC),(0.0001 BTC),0.26987 BTC,,,,,0xabc
+,,,,,"$4,977.50 ",,,,,,,,,,
+`
+
+func TestReadGemini(t *testing.T) {
+	transactions, err := ReadGemini(strings.NewReader(geminiFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 5, len(transactions)) {
+		return
+	}
+
+	buy := transactions[0]
+	assert.Equal(t, "1001", buy.ID)
+	assert.Equal(t, a.BUY, buy.Action)
+	assert.Equal(t, "BTC", buy.Asset)
+	assert.Equal(t, "0.5", buy.Quantity.String())
+	assert.Equal(t, "30000", buy.Spot.String())
+	assert.Equal(t, "22.5", buy.Fee.String())
+	assert.Equal(t, "USD", buy.Currency)
+	assert.Equal(t, "2021-01-02T12:00:00.123Z", buy.Timestamp.Format("2006-01-02T15:04:05.999Z07:00"))
+
+	// The fee is spent along with the BTC
+	convert := transactions[1]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "BTC", convert.Asset)
+	assert.Equal(t, "0.03003", convert.Quantity.String())
+	assert.Equal(t, "ETH", convert.ToAsset)
+	assert.Equal(t, "1", convert.ToQuantity.String())
+
+	interest := transactions[2]
+	assert.Equal(t, a.INCOME, interest.Action)
+	assert.Equal(t, "ETH", interest.Asset)
+	assert.Equal(t, "0.001", interest.Quantity.String())
+
+	withdrawal := transactions[3]
+	assert.Equal(t, a.TRANSFER_OUT, withdrawal.Action)
+	assert.Equal(t, "0xabc", withdrawal.ID)
+	assert.Equal(t, "0.2", withdrawal.Quantity.String())
+	fee := transactions[4]
+	assert.Equal(t, a.SELL, fee.Action)
+	assert.Equal(t, "0.0001", fee.Quantity.String())
+}
@@ -0,0 +1,379 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// krakenAssets maps Kraken's legacy asset codes to their usual tickers
+var krakenAssets = map[string]string{
+	"XXBT": "BTC",
+	"XBT":  "BTC",
+	"XXDG": "DOGE",
+	"XDG":  "DOGE",
+	"XETH": "ETH",
+	"ETH2": "ETH",
+	"XETC": "ETC",
+	"XLTC": "LTC",
+	"XXLM": "XLM",
+	"XXMR": "XMR",
+	"XXRP": "XRP",
+	"XZEC": "ZEC",
+	"XMLN": "MLN",
+	"XREP": "REP",
+	"ZUSD": "USD",
+	"ZEUR": "EUR",
+	"ZGBP": "GBP",
+	"ZCAD": "CAD",
+	"ZJPY": "JPY",
+	"ZAUD": "AUD",
+	"ZCHF": "CHF",
+}
+
+// krakenAsset normalizes a Kraken asset code, e.g. XXBT to BTC.  Staked and
+// other wallet variants such as DOT.S and ETH2.S are the same asset for tax
+// purposes, so the suffix is dropped.
+func krakenAsset(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if i := strings.Index(code, "."); i > 0 {
+		code = code[:i]
+	}
+	if asset, ok := krakenAssets[code]; ok {
+		return asset
+	}
+	return code
+}
+
+// krakenQuotes are the quote asset codes found at the end of Kraken pairs,
+// longest first so that e.g. ZUSD is matched before USD
+var krakenQuotes = []string{"USDT", "USDC", "ZUSD", "ZEUR", "ZGBP", "ZCAD", "ZJPY", "XXBT", "XETH", "USD", "EUR", "GBP", "CAD", "JPY", "XBT", "ETH", "DAI"}
+
+// krakenPair splits a Kraken pair such as XXBTZUSD or DOTUSD into its base
+// and quote assets
+func krakenPair(pair string) (string, string, error) {
+	pair = strings.ToUpper(strings.TrimSpace(pair))
+	if parts := strings.Split(pair, "/"); len(parts) == 2 {
+		return krakenAsset(parts[0]), krakenAsset(parts[1]), nil
+	}
+	for _, quote := range krakenQuotes {
+		if strings.HasSuffix(pair, quote) && len(pair) > len(quote) {
+			return krakenAsset(strings.TrimSuffix(pair, quote)), krakenAsset(quote), nil
+		}
+	}
+	return "", "", fmt.Errorf("Unrecognized Kraken pair %s", pair)
+}
+
+// krakenLeg is a single row of a Kraken ledger
+type krakenLeg struct {
+	txid    string
+	refid   string
+	kind    string
+	subtype string
+	record  []string
+	asset   string
+	amount  decimal.Decimal
+	fee     decimal.Decimal
+}
+
+// net returns the change in balance of the leg, after fees
+func (l krakenLeg) net() decimal.Decimal {
+	return l.amount.Sub(l.fee)
+}
+
+// ReadKrakenLedger reads a Kraken ledgers.csv export from r.  The two legs
+// of each trade share a refid and are joined into a single Transaction.
+// Crypto deposits and withdrawals become transfers, withdrawal fees a
+// disposal of the fee, and staking rewards income.  Transactions without a
+// fiat leg have an unknown spot price.
+func ReadKrakenLedger(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("txid", "refid", "time", "type", "asset", "amount", "fee")
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	legs := make(map[string][]krakenLeg)
+	refids := make([]string, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		// Pending deposits and withdrawals are repeated without a txid
+		if blank(record) || field(record, h.index("txid")) == "" {
+			continue
+		}
+
+		amount, err := amountField(h, record, "amount")
+		if err != nil {
+			return transactions, err
+		}
+		fee, err := amountField(h, record, "fee")
+		if err != nil {
+			return transactions, err
+		}
+
+		leg := krakenLeg{
+			txid:    field(record, h.index("txid")),
+			refid:   field(record, h.index("refid")),
+			kind:    strings.ToLower(field(record, h.index("type"))),
+			subtype: strings.ToLower(field(record, h.index("subtype"))),
+			record:  record,
+			asset:   krakenAsset(field(record, h.index("asset"))),
+			amount:  amount,
+			fee:     fee,
+		}
+		if _, ok := legs[leg.refid]; !ok {
+			refids = append(refids, leg.refid)
+		}
+		legs[leg.refid] = append(legs[leg.refid], leg)
+	}
+
+	for _, refid := range refids {
+		group := legs[refid]
+		timestamp, err := parseTimestamp(field(group[0].record, h.index("time")))
+		if err != nil {
+			return transactions, err
+		}
+
+		switch group[0].kind {
+		case "trade", "spend", "receive":
+			t, err := krakenTrade(refid, group)
+			if err != nil {
+				return transactions, err
+			}
+			if t != nil {
+				t.Timestamp = timestamp
+				transactions = append(transactions, t)
+			}
+			continue
+		}
+
+		for _, leg := range group {
+			for _, t := range krakenSingle(leg) {
+				t.Timestamp = timestamp
+				transactions = append(transactions, t)
+			}
+		}
+	}
+
+	return transactions, nil
+}
+
+// krakenTrade joins the spent and received legs of a trade
+func krakenTrade(refid string, group []krakenLeg) (*a.Transaction, error) {
+	var spent, received *krakenLeg
+	for i := range group {
+		if group[i].amount.IsNegative() {
+			spent = &group[i]
+		} else if group[i].amount.IsPositive() {
+			received = &group[i]
+		}
+	}
+	if spent == nil || received == nil {
+		return nil, fmt.Errorf("Kraken trade %s does not have a spent and a received leg", refid)
+	}
+	// A dust trade can leave nothing once the fee is paid, which has no
+	// spot price
+	if !received.net().IsPositive() {
+		return nil, fmt.Errorf("Kraken trade %s receives no %s net of fees", refid, received.asset)
+	}
+
+	spentFiat, receivedFiat := fiatCurrencies[spent.asset], fiatCurrencies[received.asset]
+	switch {
+	case spentFiat && receivedFiat:
+		log.Debugf("Skipping Kraken currency exchange %s", refid)
+		return nil, nil
+
+	case spentFiat:
+		quantity := received.net()
+		return &a.Transaction{
+			ID:       refid,
+			Action:   a.BUY,
+			Asset:    received.asset,
+			Quantity: quantity,
+			Spot:     spent.amount.Abs().Div(quantity),
+			Fee:      spent.fee,
+			Currency: spent.asset,
+		}, nil
+
+	case receivedFiat:
+		quantity := spent.net().Abs()
+		return &a.Transaction{
+			ID:       refid,
+			Action:   a.SELL,
+			Asset:    spent.asset,
+			Quantity: quantity,
+			Spot:     received.amount.Div(quantity),
+			Fee:      received.fee,
+			Currency: received.asset,
+		}, nil
+	}
+
+	return &a.Transaction{
+		ID:         refid,
+		Action:     a.CONVERT,
+		Asset:      spent.asset,
+		Quantity:   spent.net().Abs(),
+		ToAsset:    received.asset,
+		ToQuantity: received.net(),
+	}, nil
+}
+
+// krakenSingle converts a ledger row that is not part of a trade
+func krakenSingle(leg krakenLeg) []*a.Transaction {
+	transactions := make([]*a.Transaction, 0)
+	if fiatCurrencies[leg.asset] {
+		return transactions
+	}
+
+	t := &a.Transaction{
+		ID:       leg.txid,
+		Asset:    leg.asset,
+		Quantity: leg.net().Abs(),
+	}
+
+	switch leg.kind {
+	case "deposit":
+		t.Action = a.TRANSFER_IN
+
+	case "withdrawal":
+		t.Action = a.TRANSFER_OUT
+		t.Quantity = leg.amount.Abs()
+		if leg.fee.IsPositive() {
+			// The network fee is spent rather than transferred
+			transactions = append(transactions, &a.Transaction{
+				ID:       leg.txid + "-fee",
+				Action:   a.SELL,
+				Asset:    leg.asset,
+				Quantity: leg.fee,
+			})
+		}
+
+	case "staking":
+		t.Action = a.INCOME
+
+	case "earn":
+		if leg.subtype != "reward" {
+			return transactions
+		}
+		t.Action = a.INCOME
+
+	case "transfer":
+		// Moves between the spot and staking wallets are not transactions,
+		// other transfers are airdrops and forks
+		if strings.Contains(leg.subtype, "staking") || leg.amount.IsNegative() {
+			return transactions
+		}
+		t.Action = a.INCOME
+
+	default:
+		log.Warnf("Skipping Kraken %s %s", leg.kind, leg.txid)
+		return transactions
+	}
+
+	if t.Quantity.IsZero() {
+		return transactions
+	}
+	return append([]*a.Transaction{t}, transactions...)
+}
+
+// ReadKrakenTrades reads a Kraken trades.csv export from r.  Fees are paid
+// in the quote asset.  Pairs quoted in another crypto become CONVERTs with
+// an unknown spot price.
+func ReadKrakenTrades(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("txid", "pair", "time", "type", "price", "cost", "fee", "vol")
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		txid := field(record, h.index("txid"))
+		base, quote, err := krakenPair(field(record, h.index("pair")))
+		if err != nil {
+			return transactions, err
+		}
+		timestamp, err := parseTimestamp(field(record, h.index("time")))
+		if err != nil {
+			return transactions, err
+		}
+
+		amounts := make([]decimal.Decimal, 0, 4)
+		for _, name := range []string{"price", "cost", "fee", "vol"} {
+			amount, err := amountField(h, record, name)
+			if err != nil {
+				return transactions, err
+			}
+			amounts = append(amounts, amount)
+		}
+		price, cost, fee, vol := amounts[0], amounts[1], amounts[2], amounts[3]
+
+		t := &a.Transaction{
+			ID:        txid,
+			Timestamp: timestamp,
+			Asset:     base,
+			Quantity:  vol,
+			Spot:      price,
+			Fee:       fee,
+			Currency:  quote,
+		}
+		switch strings.ToLower(field(record, h.index("type"))) {
+		case "buy":
+			t.Action = a.BUY
+		case "sell":
+			t.Action = a.SELL
+		default:
+			return transactions, fmt.Errorf("Invalid type %s in Kraken trade %s", field(record, h.index("type")), txid)
+		}
+
+		if !fiatCurrencies[quote] {
+			converted := &a.Transaction{
+				ID:        txid,
+				Timestamp: timestamp,
+				Action:    a.CONVERT,
+			}
+			if t.Action == a.BUY {
+				converted.Asset, converted.Quantity = quote, cost.Add(fee)
+				converted.ToAsset, converted.ToQuantity = base, vol
+			} else {
+				converted.Asset, converted.Quantity = base, vol
+				converted.ToAsset, converted.ToQuantity = quote, cost.Sub(fee)
+			}
+			t = converted
+		}
+
+		transactions = append(transactions, t)
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+const krakenLedgerFile = `"txid","refid","time","type","subtype","aclass","asset","amount","fee","balance"
+"L1","D1","2021-01-01 09:00:00","deposit","","currency","ZUSD",20000.0000,0.0000,20000.0000
+"L2","T1","2021-01-02 12:00:00","trade","","currency","ZUSD",-15000.0000,24.0000,4976.0000
+"L3","T1","2021-01-02 12:00:00","trade","","currency","XXBT",0.5000000000,0.0000000000,0.5000000000
+"","D2","2021-01-03 08:00:00","deposit","","currency","XETH",2.0000000000,0.0000000000,
+"L4","D2","2021-01-03 08:10:00","deposit","","currency","XETH",2.0000000000,0.0000000000,2.0000000000
+"L5","T2","2021-01-04 12:00:00","trade","","currency","XETH",-1.0000000000,0.0000000000,1.0000000000
+"L6","T2","2021-01-04 12:00:00","trade","","currency","XXBT",0.0300000000,0.0000500000,0.5299500000
+"L7","S1","2021-01-05 00:00:00","staking","","currency","DOT.S",1.5000000000,0.0000000000,1.5000000000
+"L8","S2","2021-01-05 00:00:00","transfer","spottostaking","currency","DOT.S",10.0000000000,0.0000000000,11.5000000000
+"L9","W1","2021-01-06 10:00:00","withdrawal","","currency","XXBT",-0.2000000000,0.0005000000,0.3294500000
+"L10","T3","2021-01-07 12:00:00","trade","","currency","XXBT",-0.1000000000,0.0000000000,0.2294500000
+"L11","T3","2021-01-07 12:00:00","trade","","currency","ZEUR",2500.0000,4.0000,2496.0000
+`
+
+func TestReadKrakenLedger(t *testing.T) {
+	transactions, err := ReadKrakenLedger(strings.NewReader(krakenLedgerFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 7, len(transactions)) {
+		return
+	}
+
+	buy := transactions[0]
+	assert.Equal(t, "T1", buy.ID)
+	assert.Equal(t, a.BUY, buy.Action)
+	assert.Equal(t, "BTC", buy.Asset)
+	assert.Equal(t, "0.5", buy.Quantity.String())
+	assert.Equal(t, "30000", buy.Spot.String())
+	assert.Equal(t, "24", buy.Fee.String())
+	assert.Equal(t, "USD", buy.Currency)
+
+	// The pending row without a txid is skipped
+	deposit := transactions[1]
+	assert.Equal(t, a.TRANSFER_IN, deposit.Action)
+	assert.Equal(t, "ETH", deposit.Asset)
+	assert.Equal(t, "2", deposit.Quantity.String())
+	assert.Equal(t, "2021-01-03T08:10:00Z", deposit.Timestamp.Format("2006-01-02T15:04:05Z07:00"))
+
+	convert := transactions[2]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "ETH", convert.Asset)
+	assert.Equal(t, "1", convert.Quantity.String())
+	assert.Equal(t, "BTC", convert.ToAsset)
+	assert.Equal(t, "0.02995", convert.ToQuantity.String())
+
+	// Staked DOT is DOT, and moving it into staking is not a transaction
+	staking := transactions[3]
+	assert.Equal(t, a.INCOME, staking.Action)
+	assert.Equal(t, "DOT", staking.Asset)
+	assert.Equal(t, "1.5", staking.Quantity.String())
+
+	withdrawal := transactions[4]
+	assert.Equal(t, a.TRANSFER_OUT, withdrawal.Action)
+	assert.Equal(t, "0.2", withdrawal.Quantity.String())
+	fee := transactions[5]
+	assert.Equal(t, a.SELL, fee.Action)
+	assert.Equal(t, "BTC", fee.Asset)
+	assert.Equal(t, "0.0005", fee.Quantity.String())
+
+	sell := transactions[6]
+	assert.Equal(t, a.SELL, sell.Action)
+	assert.Equal(t, "0.1", sell.Quantity.String())
+	assert.Equal(t, "25000", sell.Spot.String())
+	assert.Equal(t, "4", sell.Fee.String())
+	assert.Equal(t, "EUR", sell.Currency)
+}
+
+func TestReadKrakenLedgerDust(t *testing.T) {
+	// The whole amount received is paid as the fee
+	dust := `"txid","refid","time","type","subtype","aclass","asset","amount","fee","balance"
+"L1","T1","2021-01-02 12:00:00","trade","","currency","ZUSD",-0.0100,0.0000,0.0000
+"L2","T1","2021-01-02 12:00:00","trade","","currency","XXBT",0.0000002000,0.0000002000,0.0000000000
+`
+	_, err := ReadKrakenLedger(strings.NewReader(dust))
+	assert.Error(t, err)
+}
+
+const krakenTradesFile = `"txid","ordertxid","pair","time","type","ordertype","price","cost","fee","vol","margin","misc","ledgers"
+"TX1","O1","XXBTZUSD","2021-01-02 12:00:00.1234","buy","limit",30000.00000,15000.00000,24.00000,0.50000000,0.00000,"","L2,L3"
+"TX2","O2","DOTETH","2021-01-03 12:00:00","sell","market",0.01000,0.10000,0.00020,10.00000000,0.00000,"",""
+`
+
+func TestReadKrakenTrades(t *testing.T) {
+	transactions, err := ReadKrakenTrades(strings.NewReader(krakenTradesFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 2, len(transactions)) {
+		return
+	}
+
+	buy := transactions[0]
+	assert.Equal(t, a.BUY, buy.Action)
+	assert.Equal(t, "BTC", buy.Asset)
+	assert.Equal(t, "0.5", buy.Quantity.String())
+	assert.Equal(t, "30000", buy.Spot.String())
+	assert.Equal(t, "USD", buy.Currency)
+
+	convert := transactions[1]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "DOT", convert.Asset)
+	assert.Equal(t, "10", convert.Quantity.String())
+	assert.Equal(t, "ETH", convert.ToAsset)
+	assert.Equal(t, "0.0998", convert.ToQuantity.String())
+}
+
+func TestKrakenAsset(t *testing.T) {
+	for code, asset := range map[string]string{"XXBT": "BTC", "ZUSD": "USD", "DOT.S": "DOT", "ETH2.S": "ETH", "SOL": "SOL"} {
+		assert.Equal(t, asset, krakenAsset(code))
+	}
+}
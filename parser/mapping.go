@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// Mapping describes the layout of an exchange csv export, so that it can be
+// read without a dedicated parser.  Each column field is the name of a
+// column in the header row.  Timestamp, Type, Asset and Quantity are
+// required.  TimestampLayout is a Go time layout, or "unix" for seconds
+// since the epoch, and defaults to the common exchange formats.  Currency
+// is a column, and DefaultCurrency is used when it is missing or empty.
+// Types maps the values of the Type column to Action names; rows of any
+// other type are skipped.  Counterparty is the donor or recipient of a gift,
+// and DonorBasis and DonorDate the donor's total cost basis and acquisition
+// date of a gift received.
+type Mapping struct {
+	ID              string            `json:"id"`
+	Timestamp       string            `json:"timestamp"`
+	TimestampLayout string            `json:"timestamp_layout"`
+	Type            string            `json:"type"`
+	Asset           string            `json:"asset"`
+	Quantity        string            `json:"quantity"`
+	Price           string            `json:"price"`
+	Currency        string            `json:"currency"`
+	DefaultCurrency string            `json:"default_currency"`
+	Fee             string            `json:"fee"`
+	ToAsset         string            `json:"to_asset"`
+	ToQuantity      string            `json:"to_quantity"`
+	Counterparty    string            `json:"counterparty"`
+	DonorBasis      string            `json:"donor_basis"`
+	DonorDate       string            `json:"donor_date"`
+	Types           map[string]string `json:"types"`
+
+	actions map[string]a.Action
+}
+
+// LoadMapping reads a Mapping from a JSON file
+func LoadMapping(filename string) (*Mapping, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseMapping(file)
+}
+
+// ParseMapping reads a Mapping in JSON format from r, checking that it names
+// every required column and that its types map to valid Actions
+func ParseMapping(r io.Reader) (*Mapping, error) {
+	m := &Mapping{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(m); err != nil {
+		return nil, fmt.Errorf("Invalid mapping: %s", err)
+	}
+
+	required := []struct {
+		name   string
+		column string
+	}{
+		{"timestamp", m.Timestamp},
+		{"type", m.Type},
+		{"asset", m.Asset},
+		{"quantity", m.Quantity},
+	}
+	for _, r := range required {
+		if r.column == "" {
+			return nil, fmt.Errorf("Invalid mapping: missing '%s' column", r.name)
+		}
+	}
+	if len(m.Types) == 0 {
+		return nil, fmt.Errorf("Invalid mapping: no types")
+	}
+
+	m.actions = make(map[string]a.Action)
+	for kind, name := range m.Types {
+		action, err := a.ParseAction(name)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid mapping for type '%s': %s", kind, err)
+		}
+		m.actions[strings.ToLower(strings.TrimSpace(kind))] = action
+	}
+	return m, nil
+}
+
+func (m *Mapping) timestamp(value string) (time.Time, error) {
+	switch m.TimestampLayout {
+	case "":
+		return parseTimestamp(value)
+	case "unix":
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid time %s", value)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	t, err := time.Parse(m.TimestampLayout, value)
+	if err != nil {
+		return t, fmt.Errorf("Invalid time %s", value)
+	}
+	return t.UTC(), nil
+}
+
+// date parses a date that may have no time of day, such as a donor's
+// acquisition date, which is often only known to the day
+func (m *Mapping) date(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", strings.TrimSpace(value)); err == nil {
+		return t, nil
+	}
+	return m.timestamp(value)
+}
+
+// Read reads the transactions of a csv export laid out as described by the
+// Mapping from r.  It has the signature of a Reader.
+func (m *Mapping) Read(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has(m.Timestamp, m.Type, m.Asset, m.Quantity)
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	// Optional columns that are named by the mapping must be present
+	for _, name := range []string{m.ID, m.Price, m.Currency, m.Fee, m.ToAsset, m.ToQuantity, m.Counterparty, m.DonorBasis, m.DonorDate} {
+		if name != "" && !h.has(name) {
+			return transactions, fmt.Errorf("Missing heading '%s'", name)
+		}
+	}
+
+	// column returns the value of a column named by the mapping, or "" when
+	// the mapping does not name it
+	column := func(record []string, name string) string {
+		if name == "" {
+			return ""
+		}
+		return field(record, h.index(name))
+	}
+	amount := func(record []string, name string) (decimal.Decimal, error) {
+		value := column(record, name)
+		amount, err := parseAmount(value)
+		if err != nil {
+			return amount, fmt.Errorf("Invalid %s %s", name, value)
+		}
+		return amount, nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		kind := column(record, m.Type)
+		action, ok := m.actions[strings.ToLower(kind)]
+		if !ok {
+			log.Warnf("Skipping unknown transaction type '%s' on %s", kind, column(record, m.Timestamp))
+			continue
+		}
+
+		timestamp, err := m.timestamp(column(record, m.Timestamp))
+		if err != nil {
+			return transactions, err
+		}
+
+		quantity, err := amount(record, m.Quantity)
+		if err != nil {
+			return transactions, err
+		}
+		spot, err := amount(record, m.Price)
+		if err != nil {
+			return transactions, err
+		}
+		fee, err := amount(record, m.Fee)
+		if err != nil {
+			return transactions, err
+		}
+		toQuantity, err := amount(record, m.ToQuantity)
+		if err != nil {
+			return transactions, err
+		}
+
+		donorBasis, err := amount(record, m.DonorBasis)
+		if err != nil {
+			return transactions, err
+		}
+		var donorAcquired time.Time
+		if value := column(record, m.DonorDate); value != "" {
+			if donorAcquired, err = m.date(value); err != nil {
+				return transactions, err
+			}
+		}
+
+		currency := strings.ToUpper(column(record, m.Currency))
+		if currency == "" {
+			currency = strings.ToUpper(m.DefaultCurrency)
+		}
+
+		transaction := &a.Transaction{
+			ID:         column(record, m.ID),
+			Timestamp:  timestamp,
+			Action:     action,
+			Asset:      strings.ToUpper(column(record, m.Asset)),
+			Quantity:   quantity.Abs(),
+			Spot:       spot,
+			Fee:        fee.Abs(),
+			Currency:   currency,
+			ToAsset:    strings.ToUpper(column(record, m.ToAsset)),
+			ToQuantity: toQuantity.Abs(),
+
+			Counterparty:  column(record, m.Counterparty),
+			DonorBasis:    donorBasis.Abs(),
+			DonorAcquired: donorAcquired,
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
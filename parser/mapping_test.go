@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+const mappingJSON = `{
+  "id": "Ref",
+  "timestamp": "When",
+  "timestamp_layout": "01/02/2006 15:04",
+  "type": "Kind",
+  "asset": "Coin",
+  "quantity": "Amount",
+  "price": "Price",
+  "default_currency": "usd",
+  "fee": "Fee",
+  "to_asset": "Received Coin",
+  "to_quantity": "Received Amount",
+  "types": {"Purchase": "BUY", "swap": "convert", "Reward": "INCOME"}
+}`
+
+const mappedFile = `Ref,When,Kind,Coin,Amount,Price,Fee,Received Coin,Received Amount
+a1,01/02/2021 12:00,Purchase,btc,0.5,"$30,000.00",$25.00,,
+a2,01/03/2021 12:00,Swap,BTC,0.1,,,ETH,3
+a3,01/04/2021 12:00,Withdrawal,BTC,0.1,,,,
+a4,01/05/2021 00:00,Reward,ETH,0.01,1000,,,
+`
+
+func TestMapping(t *testing.T) {
+	m, err := ParseMapping(strings.NewReader(mappingJSON))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	transactions, err := m.Read(strings.NewReader(mappedFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 3, len(transactions)) {
+		return
+	}
+
+	buy := transactions[0]
+	assert.Equal(t, "a1", buy.ID)
+	assert.Equal(t, a.BUY, buy.Action)
+	assert.Equal(t, "2021-01-02T12:00:00Z", buy.Timestamp.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, "BTC", buy.Asset)
+	assert.Equal(t, "0.5", buy.Quantity.String())
+	assert.Equal(t, "30000", buy.Spot.String())
+	assert.Equal(t, "25", buy.Fee.String())
+	assert.Equal(t, "USD", buy.Currency)
+
+	convert := transactions[1]
+	assert.Equal(t, a.CONVERT, convert.Action)
+	assert.Equal(t, "ETH", convert.ToAsset)
+	assert.Equal(t, "3", convert.ToQuantity.String())
+
+	assert.Equal(t, a.INCOME, transactions[2].Action)
+}
+
+func TestParseMappingInvalid(t *testing.T) {
+	_, err := ParseMapping(strings.NewReader(`{"timestamp": "Date", "type": "Kind", "asset": "Coin", "types": {"Buy": "BUY"}}`))
+	assert.Error(t, err)
+
+	_, err = ParseMapping(strings.NewReader(`{"timestamp": "Date", "type": "Kind", "asset": "Coin", "quantity": "Amount", "types": {"Buy": "PURCHASE"}}`))
+	assert.Error(t, err)
+
+	m, err := ParseMapping(strings.NewReader(`{"timestamp": "Date", "type": "Kind", "asset": "Coin", "quantity": "Amount", "fee": "Fee", "types": {"Buy": "BUY"}}`))
+	assert.Nil(t, err)
+	_, err = m.Read(strings.NewReader("Date,Kind,Coin,Amount\n"))
+	assert.Error(t, err)
+}
+
+func TestMappingGifts(t *testing.T) {
+	m, err := ParseMapping(strings.NewReader(`{
+  "timestamp": "Date",
+  "type": "Kind",
+  "asset": "Coin",
+  "quantity": "Amount",
+  "price": "Price",
+  "default_currency": "USD",
+  "counterparty": "From/To",
+  "donor_basis": "Donor Basis",
+  "donor_date": "Donor Date",
+  "types": {"Gift received": "GIFT_IN", "Gift sent": "GIFT_OUT"}
+}`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	transactions, err := m.Read(strings.NewReader(`Date,Kind,Coin,Amount,Price,From/To,Donor Basis,Donor Date
+2021-03-01 12:00:00,Gift received,BTC,0.5,50000,Alice,"$5,000.00",2017-06-01
+2021-04-01 12:00:00,Gift sent,BTC,0.1,58000,Bob,,
+`))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 2, len(transactions)) {
+		return
+	}
+
+	in := transactions[0]
+	assert.Equal(t, a.GIFT_IN, in.Action)
+	assert.Equal(t, "Alice", in.Counterparty)
+	assert.Equal(t, "5000", in.DonorBasis.String())
+	assert.Equal(t, "2017-06-01", in.DonorAcquired.Format("2006-01-02"))
+
+	out := transactions[1]
+	assert.Equal(t, a.GIFT_OUT, out.Action)
+	assert.Equal(t, "Bob", out.Counterparty)
+	assert.True(t, out.DonorBasis.IsZero())
+	assert.True(t, out.DonorAcquired.IsZero())
+}
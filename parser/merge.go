@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// detectionOrder is the order in which ReadAuto tries each format
+var detectionOrder = []string{"coinbase", "coinbasepro", "kraken", "krakentrades", "binance", "binancehistory", "gemini", "electrum", "sparrow", "ledgerlive", "etherscan"}
+
+// ReadAuto reads transactions from r in the first of the Readers formats
+// whose header row is found in it
+func ReadAuto(r io.Reader) ([]*a.Transaction, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return make([]*a.Transaction, 0), err
+	}
+
+	for _, format := range detectionOrder {
+		transactions, err := ReadFormat(format, bytes.NewReader(data))
+		if _, ok := err.(*NoHeaderErr); ok {
+			continue
+		}
+		log.Debugf("Read %d transactions in %s format", len(transactions), format)
+		return transactions, err
+	}
+	return make([]*a.Transaction, 0), fmt.Errorf("Unrecognized file format")
+}
+
+// duplicateKeys are the keys that identify a transaction as a duplicate:
+// its source ID, and its details for sources without IDs.  IDs are only
+// unique within a source and action, as the two sides of a transfer between
+// wallets share a transaction hash, and trade IDs of different exchanges
+// can collide.
+func duplicateKeys(t *a.Transaction) (string, string) {
+	details := fmt.Sprintf("%d/%s/%s/%s", t.Timestamp.Unix(), t.Action, t.Asset, t.Quantity)
+	if t.ID == "" {
+		return "", details
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", t.Source, t.ID, t.Action, t.Asset), details
+}
+
+// Merge combines the transactions read from several sources into a single
+// chronological list, dropping the transactions already read from an
+// earlier source.  A transaction is a duplicate if it has the same Source,
+// ID, action and asset as one from an earlier source, or, when either has
+// no ID, the same timestamp, action, asset and quantity.  Repeats within a
+// single source are kept, as they are separate transactions.  The dropped
+// duplicates are returned too.
+func Merge(sources ...[]*a.Transaction) ([]*a.Transaction, []*a.Transaction) {
+	merged := make([]*a.Transaction, 0)
+	dropped := make([]*a.Transaction, 0)
+
+	// The number of transactions with each key in any one earlier source,
+	// which is how many of them a later source may repeat
+	seenIDs := make(map[string]int)
+	seenDetails := make(map[string]int)
+	seenWithoutID := make(map[string]int)
+
+	for _, source := range sources {
+		ids := make(map[string]int)
+		details := make(map[string]int)
+		withoutID := make(map[string]int)
+		matched := make(map[string]int)
+
+		for _, t := range source {
+			id, detail := duplicateKeys(t)
+
+			var duplicate bool
+			if id != "" {
+				duplicate = ids[id] < seenIDs[id]
+				if !duplicate && matched[detail] < seenWithoutID[detail] {
+					// The same transaction read from a source without IDs
+					matched[detail]++
+					duplicate = true
+				}
+				ids[id]++
+			} else {
+				duplicate = details[detail] < seenDetails[detail]
+				withoutID[detail]++
+			}
+			details[detail]++
+
+			if duplicate {
+				dropped = append(dropped, t)
+			} else {
+				merged = append(merged, t)
+			}
+		}
+
+		for key, n := range ids {
+			if n > seenIDs[key] {
+				seenIDs[key] = n
+			}
+		}
+		for key, n := range details {
+			if n > seenDetails[key] {
+				seenDetails[key] = n
+			}
+		}
+		for key, n := range withoutID {
+			if n > seenWithoutID[key] {
+				seenWithoutID[key] = n
+			}
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+	return merged, dropped
+}
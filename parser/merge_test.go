@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAuto(t *testing.T) {
+	for name, file := range map[string]string{
+		"coinbase":    standardFile,
+		"coinbasepro": coinbaseProFile,
+		"kraken":      krakenLedgerFile,
+		"binance":     binanceTradesFile,
+		"gemini":      geminiFile,
+		"electrum":    electrumFile,
+		"sparrow":     sparrowFile,
+		"ledgerlive":  ledgerLiveFile,
+	} {
+		expected, err := ReadFormat(name, strings.NewReader(file))
+		assert.Nil(t, err)
+
+		transactions, err := ReadAuto(strings.NewReader(file))
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected, transactions, name)
+	}
+
+	_, err := ReadAuto(strings.NewReader("a,b,c\n1,2,3\n"))
+	assert.Error(t, err)
+}
+
+func TestMerge(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	transaction := func(id string, days int, action a.Action, quantity int64) *a.Transaction {
+		return &a.Transaction{
+			ID:        id,
+			Timestamp: t0.AddDate(0, 0, days),
+			Action:    action,
+			Asset:     "BTC",
+			Quantity:  decimal.NewFromInt(quantity),
+		}
+	}
+
+	// Two overlapping exports of one account
+	first := []*a.Transaction{
+		transaction("1", 0, a.BUY, 1),
+		transaction("2", 2, a.SELL, 1),
+	}
+	second := []*a.Transaction{
+		transaction("2", 2, a.SELL, 1),
+		transaction("3", 3, a.BUY, 2),
+	}
+	// An export without IDs, with two identical fills, one already read
+	third := []*a.Transaction{
+		transaction("", 1, a.BUY, 1),
+		transaction("", 1, a.BUY, 1),
+		transaction("", 3, a.BUY, 2),
+	}
+	// and a fourth source repeating both fills
+	fourth := []*a.Transaction{
+		transaction("4", 1, a.BUY, 1),
+		transaction("5", 1, a.BUY, 1),
+	}
+
+	merged, dropped := Merge(first, second, third, fourth)
+	if !assert.Equal(t, 5, len(merged)) {
+		return
+	}
+	days := make([]int, 0, len(merged))
+	for _, t := range merged {
+		days = append(days, int(t.Timestamp.Sub(t0).Hours()/24))
+	}
+	assert.Equal(t, []int{0, 1, 1, 2, 3}, days)
+
+	assert.Equal(t, []*a.Transaction{second[0], third[2], fourth[0], fourth[1]}, dropped)
+}
+
+func TestMergeTransfer(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// A transfer between two wallets, read from the export of each
+	out := &a.Transaction{ID: "abc", Source: "electrum", Timestamp: t0, Action: a.TRANSFER_OUT, Asset: "BTC", Quantity: decimal.NewFromInt(1)}
+	in := &a.Transaction{ID: "abc", Source: "sparrow", Timestamp: t0, Action: a.TRANSFER_IN, Asset: "BTC", Quantity: decimal.NewFromInt(1)}
+	merged, dropped := Merge([]*a.Transaction{out}, []*a.Transaction{in})
+	assert.Equal(t, []*a.Transaction{out, in}, merged)
+	assert.Equal(t, 0, len(dropped))
+
+	// Trades of different exchanges with the same ID
+	kraken := &a.Transaction{ID: "1", Source: "krakentrades", Timestamp: t0, Action: a.BUY, Asset: "BTC", Quantity: decimal.NewFromInt(1)}
+	gemini := &a.Transaction{ID: "1", Source: "gemini", Timestamp: t0.AddDate(0, 0, 1), Action: a.BUY, Asset: "BTC", Quantity: decimal.NewFromInt(2)}
+	merged, dropped = Merge([]*a.Transaction{kraken}, []*a.Transaction{gemini})
+	assert.Equal(t, 2, len(merged))
+	assert.Equal(t, 0, len(dropped))
+
+	// Overlapping exports of the same wallet still have duplicates
+	repeat := *in
+	_, dropped = Merge([]*a.Transaction{out, in}, []*a.Transaction{&repeat})
+	assert.Equal(t, []*a.Transaction{&repeat}, dropped)
+}
@@ -1,50 +1,153 @@
 package parser
 
 import (
-	"bufio"
-	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
-	"time"
 
 	"github.com/shopspring/decimal"
 	log "github.com/sirupsen/logrus"
 	a "github.com/sklarsa/crypto-taxes/accounting"
 )
 
-var expectedHeaders = [9]string{"Timestamp", "Transaction Type", "Asset", "Quantity Transacted", "USD Spot Price at Transaction", "USD Subtotal", "USD Total (inclusive of fees)", "USD Fees", "Notes"}
+// conversionNotes matches the Notes of a Coinbase Convert transaction,
+// e.g. "Converted 0.5 ETH to 10 LINK"
+var conversionNotes = regexp.MustCompile(`^Converted ([\d,.]+) (\S+) to ([\d,.]+) (\S+)`)
+
+// parseConversion sets the asset and quantity received by a Convert
+// transaction from its Notes
+func parseConversion(t *a.Transaction, notes string) error {
+	match := conversionNotes.FindStringSubmatch(strings.TrimSpace(notes))
+	if match == nil {
+		return fmt.Errorf("Unrecognized conversion notes '%s'", notes)
+	}
+
+	quantity, err := decimal.NewFromString(strings.ReplaceAll(match[3], ",", ""))
+	if err != nil {
+		return fmt.Errorf("Invalid conversion quantity %s", match[3])
+	}
+
+	t.ToAsset = match[4]
+	t.ToQuantity = quantity
+	return nil
+}
+
+// Reader reads the transactions of a single export format.  Transactions
+// the export has no price for have a zero Spot or FeeSpot, which must be
+// found in a price history given to the Account.
+type Reader func(r io.Reader) ([]*a.Transaction, error)
+
+// Readers maps the name of each supported export format to its Reader
+var Readers = map[string]Reader{
+	"coinbase":       ReadStandard,
+	"coinbasepro":    ReadCoinbaseProFills,
+	"binance":        ReadBinanceTrades,
+	"binancehistory": ReadBinanceTransactions,
+	"gemini":         ReadGemini,
+	"etherscan":      ReadEtherscan,
+	"electrum":       ReadElectrum,
+	"sparrow":        ReadSparrow,
+	"ledgerlive":     ReadLedgerLive,
+	"kraken":         ReadKrakenLedger,
+	"krakentrades":   ReadKrakenTrades,
+}
+
+// ReadFormat reads transactions from r with the Reader of format, recording
+// the format as the Source of each transaction
+func ReadFormat(format string, r io.Reader) ([]*a.Transaction, error) {
+	read, ok := Readers[format]
+	if !ok {
+		return make([]*a.Transaction, 0), fmt.Errorf("Unknown format '%s'", format)
+	}
+
+	transactions, err := read(r)
+	for _, t := range transactions {
+		t.Source = format
+	}
+	return transactions, err
+}
 
 // ReadStandardFile reads a transaction history csv file exported from Coinbase for a standard account,
 // returning a slice of Transactions to be processed by an Account struct
 func ReadStandardFile(filename string) ([]*a.Transaction, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return make([]*a.Transaction, 0), err
+	}
+	defer file.Close()
+
+	return ReadStandard(file)
+}
+
+// standardColumns are the names of the columns read from a Coinbase
+// standard account export, including the names used by newer exports
+var standardColumns = struct {
+	id        []string
+	timestamp []string
+	kind      []string
+	asset     []string
+	quantity  []string
+	spot      []string
+	currency  []string
+	fee       []string
+	notes     []string
+}{
+	id:        []string{"ID"},
+	timestamp: []string{"Timestamp"},
+	kind:      []string{"Transaction Type"},
+	asset:     []string{"Asset"},
+	quantity:  []string{"Quantity Transacted"},
+	spot:      []string{"Spot Price at Transaction", "Price at Transaction"},
+	currency:  []string{"Spot Price Currency", "Price Currency"},
+	fee:       []string{"Fees", "Fees and/or Spread"},
+	notes:     []string{"Notes"},
+}
+
+// ReadStandard reads a Coinbase standard account transaction history csv
+// from r, returning a slice of Transactions to be processed by an Account struct.
+// The header row is found by its content, so any preamble before it is
+// skipped, and columns are read by name in any order.
+func ReadStandard(r io.Reader) ([]*a.Transaction, error) {
 	transactions := make([]*a.Transaction, 0)
 
-	file, err := os.Open(filename)
+	cols := standardColumns
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.index(cols.timestamp...) >= 0 && h.index(cols.kind...) >= 0
+	})
 	if err != nil {
 		return transactions, err
 	}
-	defer file.Close()
 
-	// Skip the first 7 lines before parsing the csv data
-	skipper := bufio.NewReader(file)
-	newlineCt := 0
-	for ok := true; ok; ok = newlineCt < 7 {
-		rune, _, err := skipper.ReadRune()
-		if err != nil {
-			return transactions, err
-		}
+	// Older exports name the columns after the account currency, e.g.
+	// "USD Spot Price at Transaction" and "USD Fees"
+	headerCurrency := h.prefix(cols.spot[0])
+	if headerCurrency != "" {
+		cols.spot = append(cols.spot, headerCurrency+" "+cols.spot[0])
+		cols.fee = append(cols.fee, headerCurrency+" "+cols.fee[0])
+	} else {
+		headerCurrency = "USD"
+	}
 
-		if rune == '\n' {
-			newlineCt++
+	for _, names := range [][]string{cols.asset, cols.quantity, cols.spot} {
+		if h.index(names...) < 0 {
+			return transactions, fmt.Errorf("Missing heading '%s'", names[0])
 		}
 	}
 
-	r := csv.NewReader(skipper)
-	headerRecordFound := false
+	idCol := h.index(cols.id...)
+	timestampCol := h.index(cols.timestamp...)
+	kindCol := h.index(cols.kind...)
+	assetCol := h.index(cols.asset...)
+	quantityCol := h.index(cols.quantity...)
+	spotCol := h.index(cols.spot...)
+	currencyCol := h.index(cols.currency...)
+	feeCol := h.index(cols.fee...)
+	notesCol := h.index(cols.notes...)
+
 	for {
-		record, err := r.Read()
+		record, err := reader.Read()
 
 		if err == io.EOF {
 			break
@@ -54,34 +157,62 @@ func ReadStandardFile(filename string) ([]*a.Transaction, error) {
 		}
 
 		log.Debug(record)
-		if headerRecordFound {
+		if blank(record) {
+			continue
+		}
 
-			time, err := time.Parse("2006-01-02T15:04:05Z", record[0])
-			if err != nil {
-				return transactions, fmt.Errorf("Invalid time %s", record[0])
-			}
+		timestamp, err := parseTimestamp(field(record, timestampCol))
+		if err != nil {
+			return transactions, err
+		}
 
-			transaction := &a.Transaction{
-				Timestamp: time,
-				Action:    a.TransactionTypeToAction[record[1]],
-				Asset:     record[2],
-				Quantity:  decimal.RequireFromString(record[3]),
-				Spot:      decimal.RequireFromString(record[4]),
-				Currency:  "USD",
-			}
+		kind := field(record, kindCol)
+		action, ok := a.TransactionTypeToAction[kind]
+		if !ok {
+			log.Warnf("Skipping unknown transaction type '%s' on %s", kind, field(record, timestampCol))
+			continue
+		}
 
-			transactions = append(transactions, transaction)
+		quantity, err := parseAmount(field(record, quantityCol))
+		if err != nil {
+			return transactions, fmt.Errorf("Invalid quantity %s", field(record, quantityCol))
+		}
+
+		spot, err := parseAmount(field(record, spotCol))
+		if err != nil {
+			return transactions, fmt.Errorf("Invalid spot price %s", field(record, spotCol))
+		}
+
+		fee, err := parseAmount(field(record, feeCol))
+		if err != nil {
+			return transactions, fmt.Errorf("Invalid fee %s", field(record, feeCol))
+		}
+
+		currency := strings.ToUpper(field(record, currencyCol))
+		if currency == "" {
+			currency = headerCurrency
+		}
+
+		// Newer exports show outgoing quantities as negative
+		transaction := &a.Transaction{
+			ID:        field(record, idCol),
+			Timestamp: timestamp,
+			Action:    action,
+			Asset:     field(record, assetCol),
+			Quantity:  quantity.Abs(),
+			Spot:      spot,
+			Fee:       fee.Abs(),
+			Currency:  currency,
+		}
 
-		} else {
-			// Validate headers
-			for i := 0; i < len(expectedHeaders); i++ {
-				if strings.TrimSpace(record[i]) != expectedHeaders[i] {
-					return transactions, fmt.Errorf("Invalid heading in position %d: Found '%s' but expected '%s'", i+1, record[i], expectedHeaders[i])
-				}
+		if transaction.Action == a.CONVERT {
+			if err := parseConversion(transaction, field(record, notesCol)); err != nil {
+				log.Warnf("%s, treating it as a sale of %s", err, transaction.Asset)
+				transaction.Action = a.SELL
 			}
-			headerRecordFound = true
 		}
 
+		transactions = append(transactions, transaction)
 	}
 
 	return transactions, nil
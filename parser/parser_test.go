@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+const standardPreamble = `You can use this transaction report to inform your likely tax obligations.
+,
+Transactions
+User,Someone,id
+,
+,
+,
+`
+
+const standardFile = standardPreamble + `Timestamp,Transaction Type,Asset,Quantity Transacted,USD Spot Price at Transaction,USD Subtotal,USD Total (inclusive of fees),USD Fees,Notes
+2020-01-01T00:00:00Z,Buy,BTC,1,7000,7000,7010,10,Bought 1 BTC
+2020-02-01T00:00:00Z,Coinbase Earn,XLM,50,0.1,5,5,,Earned 50 XLM
+2020-07-01T00:00:00Z,Convert,ETH,1,250,250,252,2,"Converted 1 ETH to 1,050.5 LINK"
+2020-08-01T00:00:00Z,Unknown Type,ETH,1,250,250,250,,
+`
+
+func TestReadStandard(t *testing.T) {
+	transactions, err := ReadStandard(strings.NewReader(standardFile))
+	assert.Nil(t, err)
+
+	// The unknown transaction type is skipped
+	if assert.Equal(t, 3, len(transactions)) {
+		buy := transactions[0]
+		assert.Equal(t, a.BUY, buy.Action)
+		assert.Equal(t, "BTC", buy.Asset)
+		assert.Equal(t, "7000", buy.Spot.String())
+		assert.Equal(t, "10", buy.Fee.String())
+
+		assert.Equal(t, a.INCOME, transactions[1].Action)
+		assert.True(t, transactions[1].Fee.IsZero())
+
+		convert := transactions[2]
+		assert.Equal(t, a.CONVERT, convert.Action)
+		assert.Equal(t, "LINK", convert.ToAsset)
+		assert.Equal(t, "1050.5", convert.ToQuantity.String())
+	}
+}
+
+func TestReadStandardInvalidHeader(t *testing.T) {
+	_, err := ReadStandard(strings.NewReader(standardPreamble + "Timestamp,Type\n"))
+	assert.Error(t, err)
+}
+
+func TestReadStandardCurrentExport(t *testing.T) {
+	file := `Transactions
+User,Someone,id
+
+ID,Timestamp,Transaction Type,Asset,Quantity Transacted,Price Currency,Price at Transaction,Subtotal,Total (inclusive of fees and/or spread),Fees and/or Spread,Notes
+abc123,2023-01-05 12:34:56 UTC,Advanced Trade Buy,BTC,0.1,USD,"$17,000.50","$1,700.05","$1,710.05",$10.00,Bought 0.1 BTC
+def456,2023-02-05 01:00:00 UTC,Sell,BTC,-0.05,USD,"$23,000.00","$1,150.00","$1,140.00",$10.00,Sold 0.05 BTC
+`
+	transactions, err := ReadStandard(strings.NewReader(file))
+	assert.Nil(t, err)
+
+	if assert.Equal(t, 2, len(transactions)) {
+		buy := transactions[0]
+		assert.Equal(t, "abc123", buy.ID)
+		assert.Equal(t, a.BUY, buy.Action)
+		assert.Equal(t, "2023-01-05T12:34:56Z", buy.Timestamp.Format(time.RFC3339))
+		assert.Equal(t, "17000.5", buy.Spot.String())
+		assert.Equal(t, "10", buy.Fee.String())
+
+		sell := transactions[1]
+		assert.Equal(t, a.SELL, sell.Action)
+		assert.Equal(t, "0.05", sell.Quantity.String())
+	}
+}
+
+func TestReadStandardMissingColumn(t *testing.T) {
+	_, err := ReadStandard(strings.NewReader("Timestamp,Transaction Type,Asset\n"))
+	assert.Error(t, err)
+}
+
+func TestReadStandardCurrencies(t *testing.T) {
+	file := `Timestamp,Transaction Type,Asset,Quantity Transacted,Spot Price Currency,Spot Price at Transaction,Subtotal,Total (inclusive of fees),Fees,Notes
+2021-01-01T00:00:00Z,Buy,BTC,0.1,EUR,"€25,000.50","€2,500.05","€2,510.05",€10.00,Bought
+2021-01-02T00:00:00Z,Buy,ETH,1,gbp,£800,£800,£805,(£5.00),Bought
+`
+	transactions, err := ReadStandard(strings.NewReader(file))
+	assert.Nil(t, err)
+
+	if assert.Equal(t, 2, len(transactions)) {
+		assert.Equal(t, "EUR", transactions[0].Currency)
+		assert.Equal(t, "25000.5", transactions[0].Spot.String())
+		assert.Equal(t, "10", transactions[0].Fee.String())
+		assert.Equal(t, "GBP", transactions[1].Currency)
+		assert.Equal(t, "5", transactions[1].Fee.String())
+	}
+
+	// Older exports name the currency in the headings
+	transactions, err = ReadStandard(strings.NewReader(strings.Replace(standardFile, "USD", "CAD", -1)))
+	assert.Nil(t, err)
+	assert.Equal(t, "CAD", transactions[0].Currency)
+	assert.Equal(t, "10", transactions[0].Fee.String())
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := map[string]string{
+		"":          "0",
+		"$1,234.56": "1234.56",
+		"-$5.00":    "-5",
+		"CA$10":     "10",
+		"EUR 12.50": "12.5",
+		"12.50 EUR": "12.5",
+		"(€3.25)":   "-3.25",
+		"1.5E-7":    "0.00000015",
+		"¥1,000":    "1000",
+		"1 DOGE":    "1",
+		"EUR1.00":   "1",
+	}
+	for value, expected := range tests {
+		amount, err := parseAmount(value)
+		assert.Nil(t, err, value)
+		assert.Equal(t, expected, amount.String(), value)
+	}
+}
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// fiatCurrencies are the quote currencies that trades are priced in.  A
+// trade quoted in any other asset is a conversion between two cryptos.
+var fiatCurrencies = map[string]bool{
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"CAD": true,
+	"AUD": true,
+	"JPY": true,
+	"CHF": true,
+}
+
+// leg is an amount of an asset spent, received or paid as a fee in a trade
+type leg struct {
+	asset    string
+	quantity decimal.Decimal
+}
+
+// tradeTransaction converts a trade that spent one asset and received
+// another, paying a fee.  A fee in either asset of the trade, such as BNB
+// for a pair priced in BNB, is part of it.  A fee in a third asset is
+// recorded as FeeAsset, and as the trade has no price for it, its FeeSpot
+// must be found in a price history.
+// Trades between two cryptos become CONVERTs with an unknown spot price, and
+// trades between two fiat currencies are skipped.
+func tradeTransaction(timestamp time.Time, spent, received, fee leg) *a.Transaction {
+	spentFiat, receivedFiat := fiatCurrencies[spent.asset], fiatCurrencies[received.asset]
+	if spentFiat && receivedFiat {
+		log.Debugf("Skipping currency exchange on %s", timestamp)
+		return nil
+	}
+
+	// The fee is charged on top of the amount spent, or out of the amount
+	// received
+	t := &a.Transaction{Timestamp: timestamp}
+	switch fee.asset {
+	case "":
+	case spent.asset:
+		if spentFiat {
+			t.Fee = fee.quantity
+		} else {
+			spent.quantity = spent.quantity.Add(fee.quantity)
+		}
+	case received.asset:
+		if receivedFiat {
+			t.Fee = fee.quantity
+		} else {
+			received.quantity = received.quantity.Sub(fee.quantity)
+		}
+	default:
+		t.FeeAsset = fee.asset
+		t.FeeQuantity = fee.quantity
+	}
+
+	switch {
+	case spentFiat:
+		t.Action = a.BUY
+		t.Asset, t.Quantity, t.Currency = received.asset, received.quantity, spent.asset
+		if !received.quantity.IsZero() {
+			t.Spot = spent.quantity.Div(received.quantity)
+		}
+
+	case receivedFiat:
+		t.Action = a.SELL
+		t.Asset, t.Quantity, t.Currency = spent.asset, spent.quantity, received.asset
+		if !spent.quantity.IsZero() {
+			t.Spot = received.quantity.Div(spent.quantity)
+		}
+
+	default:
+		t.Action = a.CONVERT
+		t.Asset, t.Quantity = spent.asset, spent.quantity
+		t.ToAsset, t.ToQuantity = received.asset, received.quantity
+	}
+	return t
+}
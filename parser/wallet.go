@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// satoshis is the number of satoshis in a bitcoin
+var satoshis = decimal.New(1, 8)
+
+// walletTransactions converts a change in the balance of a self-custody
+// wallet.  An outgoing change includes the network fee, which is spent
+// rather than transferred, so it is a separate SELL.  spot is the price of
+// asset, if known.
+func walletTransactions(id string, timestamp time.Time, wallet, asset string, change, fee, spot decimal.Decimal, currency string) []*a.Transaction {
+	transactions := make([]*a.Transaction, 0, 2)
+	fee = fee.Abs()
+
+	transfer := &a.Transaction{
+		ID:        id,
+		Timestamp: timestamp,
+		Wallet:    wallet,
+		Action:    a.TRANSFER_IN,
+		Asset:     asset,
+		Quantity:  change,
+		Spot:      spot,
+		Currency:  currency,
+	}
+	if change.IsNegative() {
+		transfer.Action = a.TRANSFER_OUT
+		transfer.Quantity = change.Abs().Sub(fee)
+	}
+	if transfer.Quantity.IsPositive() {
+		transactions = append(transactions, transfer)
+	}
+
+	if change.IsNegative() && fee.IsPositive() {
+		transactions = append(transactions, &a.Transaction{
+			ID:        id + "-fee",
+			Timestamp: timestamp,
+			Wallet:    wallet,
+			Action:    a.SELL,
+			Asset:     asset,
+			Quantity:  fee,
+			Spot:      spot,
+			Currency:  currency,
+		})
+	}
+	return transactions
+}
+
+// unitPrice returns the price of one unit from the value of quantity units,
+// or zero if either is unknown
+func unitPrice(value, quantity decimal.Decimal) decimal.Decimal {
+	if value.IsZero() || quantity.IsZero() {
+		return decimal.Zero
+	}
+	return value.Abs().Div(quantity.Abs())
+}
+
+// ReadElectrum reads an Electrum history export from r.  Each value is the
+// change in the wallet's BTC balance, including the fee of outgoing
+// transactions.  Unconfirmed transactions are skipped.  The csv export does
+// not name the currency of its fiat values, so they are only used to price
+// transactions when a fiat_currency column gives it.
+func ReadElectrum(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("transaction_hash", "value", "timestamp")
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		hash := field(record, h.index("transaction_hash"))
+		timestamp, err := parseTimestamp(field(record, h.index("timestamp")))
+		if err != nil {
+			log.Warnf("Skipping unconfirmed Electrum transaction %s", hash)
+			continue
+		}
+
+		amounts := make([]decimal.Decimal, 0, 3)
+		for _, name := range []string{"value", "fee", "fiat_value"} {
+			amount, err := amountField(h, record, name)
+			if err != nil {
+				return transactions, err
+			}
+			amounts = append(amounts, amount)
+		}
+		change, fee, value := amounts[0], amounts[1], amounts[2]
+
+		spot := decimal.Zero
+		currency := strings.ToUpper(field(record, h.index("fiat_currency")))
+		if currency != "" {
+			spot = unitPrice(value, change)
+		}
+		if spot.IsZero() {
+			currency = ""
+		}
+		transactions = append(transactions, walletTransactions(hash, timestamp, "Electrum", "BTC", change, fee, spot, currency)...)
+	}
+
+	return transactions, nil
+}
+
+// sparrowAmount parses a Sparrow amount, which is in satoshis unless it has
+// a decimal point, as Sparrow shows BTC amounts with eight decimals
+func sparrowAmount(h header, record []string, name string) (decimal.Decimal, error) {
+	amount, err := amountField(h, record, name)
+	if err != nil || strings.Contains(field(record, h.index(name)), ".") {
+		return amount, err
+	}
+	return amount.Div(satoshis), nil
+}
+
+// ReadSparrow reads a Sparrow wallet transactions export from r.  Each
+// value is the change in the wallet's balance, including the fee of
+// outgoing transactions.
+func ReadSparrow(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("Label", "Value", "Balance", "Txid") && h.index("Date (UTC)", "Date") >= 0
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	// The fiat value column is named after its currency, e.g. "Value (USD)"
+	currency, valueCol := "", -1
+	for name, i := range h {
+		if strings.HasPrefix(name, "value (") && strings.HasSuffix(name, ")") {
+			currency = strings.ToUpper(strings.TrimSuffix(strings.TrimPrefix(name, "value ("), ")"))
+			valueCol = i
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		txid := field(record, h.index("Txid"))
+		timestamp, err := parseTimestamp(field(record, h.index("Date (UTC)", "Date")))
+		if err != nil {
+			log.Warnf("Skipping unconfirmed Sparrow transaction %s", txid)
+			continue
+		}
+
+		change, err := sparrowAmount(h, record, "Value")
+		if err != nil {
+			return transactions, err
+		}
+		fee, err := sparrowAmount(h, record, "Fee")
+		if err != nil {
+			return transactions, err
+		}
+		value, err := parseAmount(field(record, valueCol))
+		if err != nil {
+			return transactions, fmt.Errorf("Invalid value %s", field(record, valueCol))
+		}
+
+		spot := unitPrice(value, change)
+		transactionCurrency := currency
+		if spot.IsZero() {
+			transactionCurrency = ""
+		}
+		transactions = append(transactions, walletTransactions(txid, timestamp, "Sparrow", "BTC", change, fee, spot, transactionCurrency)...)
+	}
+
+	return transactions, nil
+}
+
+// ReadLedgerLive reads a Ledger Live operations export from r.  The amount
+// of an OUT operation includes its fees.  FEES operations, such as paying
+// for a token transfer, are a disposal of the fee, and rewards are income.
+// Transactions are tagged with the name of their Ledger account.
+func ReadLedgerLive(r io.Reader) ([]*a.Transaction, error) {
+	transactions := make([]*a.Transaction, 0)
+
+	h, reader, err := findHeader(r, func(h header) bool {
+		return h.has("Operation Date", "Currency Ticker", "Operation Type", "Operation Amount")
+	})
+	if err != nil {
+		return transactions, err
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return transactions, err
+		}
+
+		log.Debug(record)
+		if blank(record) {
+			continue
+		}
+
+		hash := field(record, h.index("Operation Hash"))
+		timestamp, err := parseTimestamp(field(record, h.index("Operation Date")))
+		if err != nil {
+			return transactions, err
+		}
+
+		amounts := make([]decimal.Decimal, 0, 3)
+		for _, name := range []string{"Operation Amount", "Operation Fees", "Countervalue at Operation Date"} {
+			amount, err := amountField(h, record, name)
+			if err != nil {
+				return transactions, err
+			}
+			amounts = append(amounts, amount.Abs())
+		}
+		amount, fee, value := amounts[0], amounts[1], amounts[2]
+
+		asset := strings.ToUpper(field(record, h.index("Currency Ticker")))
+		wallet := field(record, h.index("Account Name"))
+		spot := unitPrice(value, amount)
+		currency := ""
+		if !spot.IsZero() {
+			currency = strings.ToUpper(field(record, h.index("Countervalue Ticker")))
+		}
+
+		kind := strings.ToUpper(field(record, h.index("Operation Type")))
+		switch kind {
+		case "IN":
+			transactions = append(transactions, walletTransactions(hash, timestamp, wallet, asset, amount, decimal.Zero, spot, currency)...)
+		case "OUT", "FEES":
+			if kind == "FEES" {
+				amount = fee
+			}
+			transactions = append(transactions, walletTransactions(hash, timestamp, wallet, asset, amount.Neg(), fee, spot, currency)...)
+		case "REWARD", "REWARD_PAYOUT":
+			transactions = append(transactions, &a.Transaction{
+				ID:        hash,
+				Timestamp: timestamp,
+				Wallet:    wallet,
+				Action:    a.INCOME,
+				Asset:     asset,
+				Quantity:  amount,
+				Spot:      spot,
+				Currency:  currency,
+			})
+		default:
+			log.Warnf("Skipping Ledger Live %s operation %s", kind, hash)
+		}
+	}
+
+	return transactions, nil
+}
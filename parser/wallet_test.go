@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+const electrumFile = `transaction_hash,label,confirmations,value,fiat_value,fee,fiat_fee,timestamp
+aa01,From Coinbase,1000,0.5,15000.00,,,2021-01-02 12:00:00
+aa02,To friend,900,-0.1001,-3503.50,0.0001,3.50,2021-01-03 12:00
+aa03,,0,-0.05,-1750.00,0.0001,3.50,
+`
+
+func TestReadElectrum(t *testing.T) {
+	transactions, err := ReadElectrum(strings.NewReader(electrumFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 3, len(transactions)) {
+		return
+	}
+
+	received := transactions[0]
+	assert.Equal(t, "aa01", received.ID)
+	assert.Equal(t, a.TRANSFER_IN, received.Action)
+	assert.Equal(t, "Electrum", received.Wallet)
+	assert.Equal(t, "BTC", received.Asset)
+	assert.Equal(t, "0.5", received.Quantity.String())
+	// The currency of the fiat values is unknown
+	assert.True(t, received.Spot.IsZero())
+	assert.Equal(t, "", received.Currency)
+
+	// The value sent includes the network fee, which is disposed of
+	sent := transactions[1]
+	assert.Equal(t, a.TRANSFER_OUT, sent.Action)
+	assert.Equal(t, "0.1", sent.Quantity.String())
+	fee := transactions[2]
+	assert.Equal(t, "aa02-fee", fee.ID)
+	assert.Equal(t, a.SELL, fee.Action)
+	assert.Equal(t, "0.0001", fee.Quantity.String())
+	assert.True(t, fee.Spot.IsZero())
+
+	// A fiat_currency column gives the currency of the fiat values
+	transactions, err = ReadElectrum(strings.NewReader(`transaction_hash,label,confirmations,value,fiat_value,fiat_currency,fee,fiat_fee,timestamp
+aa02,To friend,900,-0.1001,-3503.50,EUR,0.0001,3.50,2021-01-03 12:00
+`))
+	assert.Nil(t, err)
+	if assert.Equal(t, 2, len(transactions)) {
+		assert.Equal(t, "35000", transactions[1].Spot.String())
+		assert.Equal(t, "EUR", transactions[1].Currency)
+	}
+}
+
+const sparrowFile = `Date (UTC),Label,Value,Balance,Fee,Value (USD),Txid
+2021-01-02 12:00,Deposit,50000000,50000000,,15000.00,bb01
+2021-01-03 12:00,Payment,-10010000,39990000,10000,-3503.50,bb02
+`
+
+func TestReadSparrow(t *testing.T) {
+	transactions, err := ReadSparrow(strings.NewReader(sparrowFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 3, len(transactions)) {
+		return
+	}
+
+	assert.Equal(t, a.TRANSFER_IN, transactions[0].Action)
+	assert.Equal(t, "0.5", transactions[0].Quantity.String())
+	assert.Equal(t, "30000", transactions[0].Spot.String())
+	assert.Equal(t, "USD", transactions[0].Currency)
+
+	assert.Equal(t, a.TRANSFER_OUT, transactions[1].Action)
+	assert.Equal(t, "0.1", transactions[1].Quantity.String())
+	assert.Equal(t, a.SELL, transactions[2].Action)
+	assert.Equal(t, "0.0001", transactions[2].Quantity.String())
+}
+
+const ledgerLiveFile = `Operation Date,Currency Ticker,Operation Type,Operation Amount,Operation Fees,Operation Hash,Account Name,Account xpub,Countervalue Ticker,Countervalue at Operation Date,Countervalue at CSV Export
+2021-01-02T12:00:00.000Z,BTC,IN,0.5,0.0002,cc01,Bitcoin 1,xpub1,USD,15000.00,20000.00
+2021-01-03T12:00:00.000Z,BTC,OUT,0.1001,0.0001,cc02,Bitcoin 1,xpub1,USD,3503.50,4000.00
+2021-01-04T12:00:00.000Z,ETH,FEES,0.002,0.002,cc03,Ethereum 1,0xabc,USD,2.40,3.00
+2021-01-05T12:00:00.000Z,DOT,REWARD,1.5,0,cc04,Polkadot 1,1abc,USD,15.00,20.00
+`
+
+func TestReadLedgerLive(t *testing.T) {
+	transactions, err := ReadLedgerLive(strings.NewReader(ledgerLiveFile))
+	assert.Nil(t, err)
+	if !assert.Equal(t, 5, len(transactions)) {
+		return
+	}
+
+	received := transactions[0]
+	assert.Equal(t, a.TRANSFER_IN, received.Action)
+	assert.Equal(t, "Bitcoin 1", received.Wallet)
+	assert.Equal(t, "0.5", received.Quantity.String())
+	assert.Equal(t, "USD", received.Currency)
+
+	assert.Equal(t, a.TRANSFER_OUT, transactions[1].Action)
+	assert.Equal(t, "0.1", transactions[1].Quantity.String())
+	assert.Equal(t, a.SELL, transactions[2].Action)
+	assert.Equal(t, "0.0001", transactions[2].Quantity.String())
+
+	gas := transactions[3]
+	assert.Equal(t, a.SELL, gas.Action)
+	assert.Equal(t, "ETH", gas.Asset)
+	assert.Equal(t, "0.002", gas.Quantity.String())
+	assert.Equal(t, "1200", gas.Spot.String())
+
+	reward := transactions[4]
+	assert.Equal(t, a.INCOME, reward.Action)
+	assert.Equal(t, "DOT", reward.Asset)
+	assert.Equal(t, "10", reward.Spot.String())
+}
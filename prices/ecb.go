@@ -0,0 +1,125 @@
+package prices
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ECBRates is a Source of exchange rates between currencies, from the euro
+// foreign exchange reference rates of the European Central Bank.  Rates
+// are only published on working days, so the rate on a day is the last one
+// published, up to a week before.
+type ECBRates struct {
+	// perEuro are the units of each currency per euro
+	perEuro *Files
+}
+
+// LoadECBRates reads the ECB reference rates from a csv file, such as the
+// unzipped eurofxref-hist.csv of the full history
+func LoadECBRates(filename string) (*ECBRates, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadECBRates(file)
+}
+
+// ecbLayouts are the date formats of the historical and daily rates files
+var ecbLayouts = []string{
+	"2006-01-02",
+	"02 January 2006",
+}
+
+// ReadECBRates reads the ECB reference rates in csv format from r.  Each
+// row is a date followed by the units of each currency per euro, with N/A
+// for currencies without a rate on that day.
+func ReadECBRates(r io.Reader) (*ECBRates, error) {
+	e := &ECBRates{perEuro: NewFiles()}
+	e.perEuro.Interpolation = PREVIOUS
+	e.perEuro.Tolerance = 7 * 24 * time.Hour
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return e, err
+	}
+	if column(header, "date") != 0 {
+		return e, fmt.Errorf("Missing heading 'Date'")
+	}
+
+	histories := make(map[string]History)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return e, err
+		}
+
+		var date time.Time
+		for _, layout := range ecbLayouts {
+			if date, err = time.Parse(layout, strings.TrimSpace(record[0])); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return e, fmt.Errorf("Invalid date %s", record[0])
+		}
+
+		for i := 1; i < len(record) && i < len(header); i++ {
+			currency := strings.ToUpper(strings.TrimSpace(header[i]))
+			value := strings.TrimSpace(record[i])
+			if currency == "" || value == "" || value == "N/A" {
+				continue
+			}
+			rate, err := decimal.NewFromString(value)
+			if err != nil || !rate.IsPositive() {
+				return e, fmt.Errorf("Invalid %s rate %s", currency, value)
+			}
+			histories[currency] = append(histories[currency], Point{Time: date, Price: rate})
+		}
+	}
+
+	for currency, history := range histories {
+		e.perEuro.Add("EUR", currency, history)
+	}
+	return e, nil
+}
+
+// rate returns the units of currency per euro at t
+func (e *ECBRates) rate(currency string, t time.Time) (decimal.Decimal, error) {
+	if strings.EqualFold(currency, "EUR") {
+		return decimal.NewFromInt(1), nil
+	}
+	return e.perEuro.Price("EUR", currency, t)
+}
+
+// Price returns the price of one unit of the asset currency in currency at
+// t, converting through the euro
+func (e *ECBRates) Price(asset string, currency string, t time.Time) (decimal.Decimal, error) {
+	if strings.EqualFold(asset, currency) {
+		return decimal.NewFromInt(1), nil
+	}
+
+	from, err := e.rate(asset, t)
+	if err != nil {
+		return decimal.Zero, &NoPriceErr{Asset: asset, Currency: currency, Time: t}
+	}
+	to, err := e.rate(currency, t)
+	if err != nil {
+		return decimal.Zero, &NoPriceErr{Asset: asset, Currency: currency, Time: t}
+	}
+	return to.Div(from), nil
+}
@@ -0,0 +1,72 @@
+package prices
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestECBRates(t *testing.T) {
+	data := `Date,USD,JPY,GBP,CYP,
+2021-01-05,1.2271,126.25,0.9028,N/A,
+2021-01-04,1.2296,126.62,0.9006,N/A,
+2020-12-31,1.2271,126.49,0.8990,N/A,
+`
+	rates, err := ReadECBRates(strings.NewReader(data))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	tests := []struct {
+		asset    string
+		currency string
+		time     time.Time
+		price    string
+	}{
+		{"EUR", "USD", time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC), "1.2296"},
+		{"EUR", "EUR", time.Date(2021, 1, 4, 12, 0, 0, 0, time.UTC), "1"},
+		// The rate of the last working day is used on holidays and weekends
+		{"EUR", "USD", time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC), "1.2271"},
+		{"GBP", "EUR", time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), "1.1076650420912716"},
+		// Other pairs are converted through the euro
+		{"USD", "GBP", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), "0.7324333116460638"},
+	}
+	for _, test := range tests {
+		price, err := rates.Price(test.asset, test.currency, test.time)
+		if assert.Nil(t, err, test) {
+			assert.Equal(t, test.price, price.String(), test)
+		}
+	}
+
+	for _, missing := range []struct {
+		asset    string
+		currency string
+		time     time.Time
+	}{
+		{"USD", "CYP", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"USD", "CAD", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{"USD", "EUR", time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		_, err := rates.Price(missing.asset, missing.currency, missing.time)
+		assert.IsType(t, &NoPriceErr{}, err, missing)
+	}
+
+	// The daily rates file has spaces and long dates
+	rates, err = ReadECBRates(strings.NewReader("Date, USD, JPY, \n04 January 2021, 1.2296, 126.62, \n"))
+	if assert.Nil(t, err) {
+		price, err := rates.Price("EUR", "JPY", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC))
+		assert.Nil(t, err)
+		assert.Equal(t, "126.62", price.String())
+	}
+
+	for _, invalid := range []string{
+		"USD,JPY\n1.2,126\n",
+		"Date,USD\nyesterday,1.2\n",
+		"Date,USD\n2021-01-04,0\n",
+	} {
+		_, err := ReadECBRates(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
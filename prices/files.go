@@ -0,0 +1,251 @@
+package prices
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Point is the price of an asset at a point in time
+type Point struct {
+	Time  time.Time
+	Price decimal.Decimal
+}
+
+// History is the price history of an asset in a currency, sorted by time
+type History []Point
+
+// Files is a Source backed by price histories, such as the daily or hourly
+// OHLC csv files of each asset loaded by LoadFiles.  A price is only found
+// within Tolerance of the history, defaulting to a day when zero.
+type Files struct {
+	Histories     map[string]History
+	Interpolation Interpolation
+	Tolerance     time.Duration
+}
+
+// NewFiles initializes a Files with no price histories
+func NewFiles() *Files {
+	return &Files{
+		Histories: make(map[string]History),
+	}
+}
+
+func key(asset, currency string) string {
+	return strings.ToUpper(asset) + "-" + strings.ToUpper(currency)
+}
+
+// Add adds the price history of asset in currency, merging it with any
+// history already added
+func (f *Files) Add(asset string, currency string, history History) {
+	k := key(asset, currency)
+	merged := append(f.Histories[k], history...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+	f.Histories[k] = merged
+}
+
+// LoadFiles reads the price history csv files in dir.  Each file is named
+// after its asset and currency, e.g. BTC-EUR.csv, or only its asset for
+// prices in USD, e.g. BTC.csv.
+func LoadFiles(dir string) (*Files, error) {
+	f := NewFiles()
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return f, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.ToLower(filepath.Ext(entry.Name())) != ".csv" {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		parts := strings.SplitN(name, "-", 2)
+		asset, currency := parts[0], DefaultCurrency
+		if len(parts) == 2 {
+			currency = parts[1]
+		}
+
+		history, err := readHistoryFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return f, fmt.Errorf("%s: %s", entry.Name(), err)
+		}
+		f.Add(asset, currency, history)
+	}
+	return f, nil
+}
+
+func readHistoryFile(filename string) (History, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return History{}, err
+	}
+	defer file.Close()
+
+	return ReadHistory(file)
+}
+
+// column returns the position of the first column of header found out of
+// names, or -1
+func column(header []string, names ...string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))) == name {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// timestampLayouts are the time formats found in price history files
+var timestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses a time in any of the timestampLayouts, or in seconds or
+// milliseconds since the epoch
+func parseTime(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Seconds since the epoch don't reach 1e11 until the year 5138
+		if n >= 1e11 {
+			return time.Unix(0, n*int64(time.Millisecond)).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %s", value)
+}
+
+// ReadHistory reads a price history csv from r.  The file has a header row,
+// with a time column (timestamp, time, date or unix) and either the open of
+// an OHLC candle, which is the price at the candle's time, or a single
+// price column.  Rows without a price are skipped.
+func ReadHistory(r io.Reader) (History, error) {
+	history := make(History, 0)
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return history, err
+	}
+	timeCol := column(header, "timestamp", "time", "date", "unix")
+	priceCol := column(header, "open", "price", "close")
+	if timeCol < 0 || priceCol < 0 {
+		return history, fmt.Errorf("Missing time or price heading")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return history, err
+		}
+		if len(record) <= timeCol || len(record) <= priceCol || strings.TrimSpace(record[priceCol]) == "" {
+			continue
+		}
+
+		t, err := parseTime(strings.TrimSpace(record[timeCol]))
+		if err != nil {
+			return history, err
+		}
+		price, err := decimal.NewFromString(strings.TrimSpace(record[priceCol]))
+		if err != nil {
+			return history, fmt.Errorf("Invalid price %s", record[priceCol])
+		}
+		history = append(history, Point{Time: t, Price: price})
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Time.Before(history[j].Time)
+	})
+	return history, nil
+}
+
+func (f *Files) tolerance() time.Duration {
+	if f.Tolerance == 0 {
+		return 24 * time.Hour
+	}
+	return f.Tolerance
+}
+
+// within returns true if p is within the tolerance of t
+func (f *Files) within(p Point, t time.Time) bool {
+	d := t.Sub(p.Time)
+	if d < 0 {
+		d = -d
+	}
+	return d <= f.tolerance()
+}
+
+// Price returns the price of one unit of asset in currency at t, found with
+// the Interpolation of the Files.  The price of a currency in itself is 1.
+func (f *Files) Price(asset string, currency string, t time.Time) (decimal.Decimal, error) {
+	if strings.EqualFold(asset, currency) {
+		return decimal.NewFromInt(1), nil
+	}
+	noPrice := &NoPriceErr{Asset: asset, Currency: currency, Time: t}
+
+	history := f.Histories[key(asset, currency)]
+	// after is the first point after t
+	after := sort.Search(len(history), func(i int) bool {
+		return history[i].Time.After(t)
+	})
+
+	var previous, next *Point
+	if after > 0 {
+		previous = &history[after-1]
+	}
+	if after < len(history) {
+		next = &history[after]
+	}
+
+	nearest := previous
+	if nearest == nil || (next != nil && next.Time.Sub(t) < t.Sub(previous.Time)) {
+		nearest = next
+	}
+
+	switch f.Interpolation {
+	case PREVIOUS:
+		if previous != nil && f.within(*previous, t) {
+			return previous.Price, nil
+		}
+		return decimal.Zero, noPrice
+
+	case LINEAR:
+		if previous != nil && next != nil && f.within(*nearest, t) {
+			elapsed := decimal.NewFromInt(int64(t.Sub(previous.Time)))
+			span := decimal.NewFromInt(int64(next.Time.Sub(previous.Time)))
+			return previous.Price.Add(next.Price.Sub(previous.Price).Mul(elapsed).Div(span)), nil
+		}
+	}
+
+	if nearest != nil && f.within(*nearest, t) {
+		return nearest.Price, nil
+	}
+	return decimal.Zero, noPrice
+}
@@ -0,0 +1,131 @@
+package prices
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadHistory(t *testing.T) {
+	// Daily OHLC candles in milliseconds since the epoch, out of order
+	data := `timestamp,open,high,low,close,volume
+1577923200000,7000,7200,6900,7100,10
+1577836800000,6900,7100,6800,7000,12
+1578009600000,,,,,
+`
+	history, err := ReadHistory(strings.NewReader(data))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(history)) {
+		assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), history[0].Time)
+		assert.Equal(t, "6900", history[0].Price.String())
+		assert.Equal(t, "7000", history[1].Price.String())
+	}
+
+	// A single price column, with dates
+	history, err = ReadHistory(strings.NewReader("Date,Price\n2020-01-01,6900\n2020-01-02 12:00:00,7000\n"))
+	if assert.Nil(t, err) && assert.Equal(t, 2, len(history)) {
+		assert.Equal(t, time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC), history[1].Time)
+	}
+
+	for _, invalid := range []string{
+		"date,volume\n2020-01-01,10\n",
+		"date,price\nyesterday,10\n",
+		"date,price\n2020-01-01,ten\n",
+	} {
+		_, err := ReadHistory(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFilesPrice(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	history, err := ReadHistory(strings.NewReader("time,open\n2020-01-01,100\n2020-01-02,200\n2020-01-05,500\n"))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	f := NewFiles()
+	f.Add("BTC", "USD", history)
+
+	tests := []struct {
+		interpolation Interpolation
+		time          time.Time
+		price         string
+	}{
+		{NEAREST, t0, "100"},
+		{NEAREST, t0.Add(6 * time.Hour), "100"},
+		{NEAREST, t0.Add(18 * time.Hour), "200"},
+		{PREVIOUS, t0.Add(18 * time.Hour), "100"},
+		{LINEAR, t0.Add(18 * time.Hour), "175"},
+		{LINEAR, t0.AddDate(0, 0, 1), "200"},
+		// The end of the history is within tolerance
+		{LINEAR, t0.Add(-12 * time.Hour), "100"},
+		{PREVIOUS, t0.AddDate(0, 0, 4).Add(12 * time.Hour), "500"},
+	}
+	for _, test := range tests {
+		f.Interpolation = test.interpolation
+		price, err := f.Price("btc", "usd", test.time)
+		if assert.Nil(t, err, test) {
+			assert.Equal(t, test.price, price.String(), test)
+		}
+	}
+
+	// Prices further than the tolerance from the history are not found
+	f.Interpolation = LINEAR
+	_, err = f.Price("BTC", "USD", t0.AddDate(0, 0, 2).Add(12*time.Hour))
+	assert.IsType(t, &NoPriceErr{}, err)
+	f.Interpolation = PREVIOUS
+	_, err = f.Price("BTC", "USD", t0.Add(-time.Hour))
+	assert.IsType(t, &NoPriceErr{}, err)
+	f.Tolerance = 36 * time.Hour
+	_, err = f.Price("BTC", "USD", t0.AddDate(0, 0, 2).Add(12*time.Hour))
+	assert.Nil(t, err)
+
+	_, err = f.Price("ETH", "USD", t0)
+	assert.IsType(t, &NoPriceErr{}, err)
+	_, err = f.Price("BTC", "EUR", t0)
+	assert.IsType(t, &NoPriceErr{}, err)
+
+	price, err := f.Price("USD", "USD", t0)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", price.String())
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prices")
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"BTC.csv":     "date,open\n2020-01-01,7000\n",
+		"ETH-EUR.csv": "date,open\n2020-01-01,120\n",
+		"README.txt":  "not a price file",
+	}
+	for name, data := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	f, err := LoadFiles(dir)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, 2, len(f.Histories))
+
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	price, err := f.Price("BTC", "USD", t0)
+	assert.Nil(t, err)
+	assert.Equal(t, "7000", price.String())
+	price, err = f.Price("ETH", "EUR", t0)
+	assert.Nil(t, err)
+	assert.Equal(t, "120", price.String())
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "LTC.csv"), []byte("date,open\n2020-01-01,ten\n"), 0644))
+	_, err = LoadFiles(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package prices
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultCurrency is the currency of prices when none is given
+const DefaultCurrency = "USD"
+
+// Source provides historical prices, used to value transactions whose
+// export has no spot price
+type Source interface {
+	// Price returns the price of one unit of asset in currency at t
+	Price(asset string, currency string, t time.Time) (decimal.Decimal, error)
+}
+
+// NoPriceErr is an error for a price that a Source does not have
+type NoPriceErr struct {
+	Asset    string
+	Currency string
+	Time     time.Time
+}
+
+func (m *NoPriceErr) Error() string {
+	return fmt.Sprintf("No price of %s in %s on %s", m.Asset, m.Currency, m.Time.Format(time.RFC3339))
+}
+
+// Interpolation determines how a price is found between the times of a
+// price history
+type Interpolation int
+
+const (
+	// NEAREST uses the price nearest in time
+	NEAREST Interpolation = iota
+	// PREVIOUS uses the last price at or before the time
+	PREVIOUS Interpolation = iota
+	// LINEAR interpolates linearly between the prices before and after the
+	// time, using the nearest price at either end of the history
+	LINEAR Interpolation = iota
+)
+
+// ParseInterpolation returns the Interpolation for a name (nearest, previous
+// or linear)
+func ParseInterpolation(name string) (Interpolation, error) {
+	switch strings.ToLower(name) {
+	case "nearest":
+		return NEAREST, nil
+	case "previous":
+		return PREVIOUS, nil
+	case "linear":
+		return LINEAR, nil
+	}
+	return NEAREST, fmt.Errorf("Unknown interpolation '%s'", name)
+}
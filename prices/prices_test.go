@@ -0,0 +1,28 @@
+package prices
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInterpolation(t *testing.T) {
+	for name, expected := range map[string]Interpolation{
+		"nearest":  NEAREST,
+		"Previous": PREVIOUS,
+		"LINEAR":   LINEAR,
+	} {
+		interpolation, err := ParseInterpolation(name)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, interpolation)
+	}
+
+	_, err := ParseInterpolation("cubic")
+	assert.Error(t, err)
+}
+
+func TestNoPriceErr(t *testing.T) {
+	err := &NoPriceErr{Asset: "BTC", Currency: "USD", Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	assert.Equal(t, "No price of BTC in USD on 2020-01-02T03:04:05Z", err.Error())
+}
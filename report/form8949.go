@@ -0,0 +1,141 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/shopspring/decimal"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// irsDate is the date format used on IRS forms
+const irsDate = "01/02/2006"
+
+var form8949Headers = []string{"Description of property", "Date acquired", "Date sold or disposed of", "Proceeds", "Cost or other basis", "Code", "Amount of adjustment", "Gain or (loss)"}
+
+// Totals are the summed columns of a Form 8949 part, as carried to Schedule D
+type Totals struct {
+	Proceeds   decimal.Decimal
+	Cost       decimal.Decimal
+	Adjustment decimal.Decimal
+	Gain       decimal.Decimal
+}
+
+func (t *Totals) add(s *a.Sale) {
+	t.Proceeds = t.Proceeds.Add(s.Proceeds)
+	t.Cost = t.Cost.Add(s.FifoCost)
+	t.Adjustment = t.Adjustment.Add(s.DisallowedLoss)
+	t.Gain = t.Gain.Add(s.Gain())
+}
+
+func (t Totals) record(label string) []string {
+	return []string{label, "", "", money(t.Proceeds), money(t.Cost), "", money(t.Adjustment), money(t.Gain)}
+}
+
+// SplitByTerm returns the totals of the short-term and long-term sales.
+// Pooled sales have no holding period, so they are in neither.
+func SplitByTerm(sales []*a.Sale) (Totals, Totals) {
+	var short, long Totals
+	for _, s := range sales {
+		switch s.Term() {
+		case a.SHORT_TERM:
+			short.add(s)
+		case a.LONG_TERM:
+			long.add(s)
+		}
+	}
+	return short, long
+}
+
+// checkTerms returns an error for a sale matched against a pool, which has
+// no holding period to report it under
+func checkTerms(sales []*a.Sale) error {
+	for _, s := range sales {
+		if s.Term() == a.POOLED {
+			return fmt.Errorf("Sale of %s on %s was matched against a pool, which has no holding period", Description(s), s.SaleDate.Format(irsDate))
+		}
+	}
+	return nil
+}
+
+func money(d decimal.Decimal) string {
+	return d.StringFixed(2)
+}
+
+// Description returns the Form 8949 description of a sale, e.g. "0.5 BTC"
+func Description(s *a.Sale) string {
+	return fmt.Sprintf("%s %s", s.Quantity, s.Asset)
+}
+
+// DateAcquired returns the Form 8949 date acquired of a sale
+func DateAcquired(s *a.Sale) string {
+	return s.PurchaseDate.Format(irsDate)
+}
+
+// form8949Record returns the row of a sale.  A loss disallowed by the wash
+// sale rule is an adjustment with code W.
+func form8949Record(s *a.Sale) []string {
+	code, adjustment := "", ""
+	if !s.DisallowedLoss.IsZero() {
+		code, adjustment = "W", money(s.DisallowedLoss)
+	}
+	return []string{
+		Description(s),
+		DateAcquired(s),
+		s.SaleDate.Format(irsDate),
+		money(s.Proceeds),
+		money(s.FifoCost),
+		code,
+		adjustment,
+		money(s.Gain()),
+	}
+}
+
+// WriteForm8949 writes sales as Form 8949 rows in csv format, grouped into
+// Part I (short-term) and Part II (long-term).  Crypto sales are not
+// reported on a Form 1099-B, so they are checked as box C and box F.  The
+// totals of each part are followed by the Schedule D line 3 and line 10
+// summary.  Sales matched against a pool cannot be reported.
+func WriteForm8949(w io.Writer, sales []*a.Sale) error {
+	if err := checkTerms(sales); err != nil {
+		return err
+	}
+	out := csv.NewWriter(w)
+
+	parts := []struct {
+		title string
+		term  a.Term
+	}{
+		{"Part I - Short-Term (Box C)", a.SHORT_TERM},
+		{"Part II - Long-Term (Box F)", a.LONG_TERM},
+	}
+
+	for i, part := range parts {
+		if i > 0 {
+			out.Write([]string{})
+		}
+		out.Write([]string{part.title})
+		out.Write(form8949Headers)
+
+		var totals Totals
+		for _, s := range sales {
+			if s.Term() != part.term {
+				continue
+			}
+			out.Write(form8949Record(s))
+			totals.add(s)
+		}
+		out.Write(totals.record("Totals"))
+	}
+
+	short, long := SplitByTerm(sales)
+	out.Write([]string{})
+	out.Write([]string{"Schedule D"})
+	out.Write([]string{"Line", "", "", "Proceeds", "Cost or other basis", "", "Adjustments", "Gain or (loss)"})
+	out.Write(short.record("3 - Short-term transactions not reported on Form 1099-B"))
+	out.Write(long.record("10 - Long-term transactions not reported on Form 1099-B"))
+
+	out.Flush()
+	return out.Error()
+}
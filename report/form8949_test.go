@@ -0,0 +1,94 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSales() []*a.Sale {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []*a.Sale{
+		{
+			Asset:        "BTC",
+			PurchaseDate: t0,
+			SaleDate:     t0.AddDate(0, 6, 0),
+			Quantity:     decimal.NewFromFloat(0.5),
+			FifoCost:     decimal.NewFromInt(100),
+			Proceeds:     decimal.NewFromInt(150),
+		},
+		{
+			Asset:        "ETH",
+			PurchaseDate: t0,
+			SaleDate:     t0.AddDate(2, 0, 0),
+			Quantity:     decimal.NewFromInt(2),
+			FifoCost:     decimal.NewFromInt(400),
+			Proceeds:     decimal.NewFromInt(300),
+		},
+	}
+}
+
+func TestWriteForm8949(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteForm8949(&buf, testSales())
+	assert.Nil(t, err)
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "Part I - Short-Term (Box C)", lines[0])
+	assert.Equal(t, "0.5 BTC,01/01/2020,07/01/2020,150.00,100.00,,,50.00", lines[2])
+	assert.Equal(t, "Totals,,,150.00,100.00,,0.00,50.00", lines[3])
+	assert.Equal(t, "Part II - Long-Term (Box F)", lines[5])
+	assert.Equal(t, "2 ETH,01/01/2020,01/01/2022,300.00,400.00,,,-100.00", lines[7])
+	assert.Contains(t, buf.String(), "3 - Short-term transactions not reported on Form 1099-B,,,150.00,100.00,,0.00,50.00")
+	assert.Contains(t, buf.String(), "10 - Long-term transactions not reported on Form 1099-B,,,300.00,400.00,,0.00,-100.00")
+}
+
+func washSale() *a.Sale {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &a.Sale{
+		Asset:          "ETH",
+		PurchaseDate:   t0,
+		SaleDate:       t0.AddDate(0, 2, 0),
+		Quantity:       decimal.NewFromInt(1),
+		FifoCost:       decimal.NewFromInt(200),
+		Proceeds:       decimal.NewFromInt(150),
+		DisallowedLoss: decimal.NewFromInt(30),
+	}
+}
+
+func TestWriteForm8949WashSale(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteForm8949(&buf, []*a.Sale{washSale()})
+	assert.Nil(t, err)
+
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "1 ETH,01/01/2020,03/01/2020,150.00,200.00,W,30.00,-20.00", lines[2])
+	assert.Equal(t, "Totals,,,150.00,200.00,,30.00,-20.00", lines[3])
+}
+
+func TestWritePooledSale(t *testing.T) {
+	sales := append(testSales(), &a.Sale{
+		Asset:        "BTC",
+		SaleDate:     time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		PurchaseDate: time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		Quantity:     decimal.NewFromInt(1),
+		FifoCost:     decimal.NewFromInt(100),
+		Proceeds:     decimal.NewFromInt(120),
+		Pooled:       true,
+	})
+
+	// A pooled sale has no holding period to report it under
+	var buf bytes.Buffer
+	assert.Error(t, WriteForm8949(&buf, sales))
+	assert.Error(t, WriteTXF(&buf, sales, time.Now()))
+	assert.Equal(t, 0, buf.Len())
+
+	short, long := SplitByTerm(sales)
+	assert.Equal(t, "150", short.Proceeds.String())
+	assert.Equal(t, "300", long.Proceeds.String())
+}
@@ -0,0 +1,58 @@
+package report
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+)
+
+// TXF v042 reference numbers for Form 8949 sales that were not reported on
+// a 1099-B at all, in box C (short-term) or box F (long-term), as in
+// WriteForm8949
+const (
+	txfShortTerm = 715
+	txfLongTerm  = 716
+)
+
+// WriteTXF writes sales as TXF v042 records for importing into TurboTax
+// desktop.  Each sale becomes a 1099-B record with the short-term or
+// long-term reference number, and the amount of any loss disallowed by the
+// wash sale rule.  exported is the date written to the header.  Sales
+// matched against a pool cannot be reported.
+func WriteTXF(w io.Writer, sales []*a.Sale, exported time.Time) error {
+	if err := checkTerms(sales); err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+
+	fmt.Fprint(out, "V042\n")
+	fmt.Fprint(out, "Acrypto-taxes\n")
+	fmt.Fprintf(out, "D%s\n", exported.Format(irsDate))
+	fmt.Fprint(out, "^\n")
+
+	for _, s := range sales {
+		ref := txfShortTerm
+		if s.Term() == a.LONG_TERM {
+			ref = txfLongTerm
+		}
+
+		fmt.Fprint(out, "TD\n")
+		fmt.Fprintf(out, "N%d\n", ref)
+		fmt.Fprint(out, "C1\n")
+		fmt.Fprint(out, "L1\n")
+		fmt.Fprintf(out, "P%s\n", Description(s))
+		fmt.Fprintf(out, "D%s\n", DateAcquired(s))
+		fmt.Fprintf(out, "D%s\n", s.SaleDate.Format(irsDate))
+		fmt.Fprintf(out, "$%s\n", money(s.FifoCost))
+		fmt.Fprintf(out, "$%s\n", money(s.Proceeds))
+		if !s.DisallowedLoss.IsZero() {
+			fmt.Fprintf(out, "$%s\n", money(s.DisallowedLoss))
+		}
+		fmt.Fprint(out, "^\n")
+	}
+
+	return out.Flush()
+}
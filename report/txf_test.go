@@ -0,0 +1,29 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	a "github.com/sklarsa/crypto-taxes/accounting"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTXF(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteTXF(&buf, testSales(), time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+
+	expected := "V042\nAcrypto-taxes\nD02/03/2021\n^\n" +
+		"TD\nN715\nC1\nL1\nP0.5 BTC\nD01/01/2020\nD07/01/2020\n$100.00\n$150.00\n^\n" +
+		"TD\nN716\nC1\nL1\nP2 ETH\nD01/01/2020\nD01/01/2022\n$400.00\n$300.00\n^\n"
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteTXFWashSale(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteTXF(&buf, []*a.Sale{washSale()}, time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+
+	assert.Contains(t, buf.String(), "P1 ETH\nD01/01/2020\nD03/01/2020\n$200.00\n$150.00\n$30.00\n^\n")
+}